@@ -3,6 +3,8 @@ package main
 import (
 	"log"
 	"os"
+	"runtime"
+	"slices"
 
 	bedgovcf "github.com/nvnieuwk/bedgovcf/convert"
 	cli "github.com/urfave/cli/v2"
@@ -39,53 +41,293 @@ func main() {
 				Usage:    "The BED file contains a header line",
 				Category: "Optional",
 			},
+			&cli.StringSliceFlag{
+				Name:     "region",
+				Aliases:  []string{"r"},
+				Usage:    "Only convert the rows in this region (chr, chr:start or chr:start-end, 1-based), can be given multiple times",
+				Category: "Regions",
+			},
+			&cli.StringFlag{
+				Name:     "regions-file",
+				Aliases:  []string{"R"},
+				Usage:    "Only convert the rows in the regions of this BED file",
+				Category: "Regions",
+			},
+			&cli.StringSliceFlag{
+				Name:     "contigs",
+				Usage:    "Only convert the rows on these contigs (comma-separated)",
+				Category: "Regions",
+			},
+			&cli.StringFlag{
+				Name:     "region-mode",
+				Usage:    "How rows are matched to the regions: 'overlap' (the row overlaps a region) or 'start' (the row starts within a region)",
+				Value:    "overlap",
+				Category: "Regions",
+			},
+			&cli.BoolFlag{
+				Name:     "restrict-contigs",
+				Usage:    "Only add the contig header lines of the selected contigs and regions",
+				Category: "Regions",
+			},
+			&cli.StringFlag{
+				Name:     "chrom-map",
+				Usage:    "A file with two columns (name and translation) used to translate the chromosome names of the BED file and the contigs",
+				Category: "Chromosome names",
+			},
+			&cli.StringFlag{
+				Name:     "chrom-convention",
+				Usage:    "Translate the chromosome names of the BED file and the contigs to this naming convention: 'ucsc', 'ensembl' or 'refseq'",
+				Category: "Chromosome names",
+			},
+			&cli.StringFlag{
+				Name:     "expect-assembly",
+				Usage:    "The assembly the contigs and data are expected to belong to (GRCh37, GRCh38, T2T-CHM13 or GRCm39)",
+				Category: "Assembly",
+			},
+			&cli.StringFlag{
+				Name:     "assembly-policy",
+				Usage:    "What to do when the contigs or data don't fit the detected or expected assembly: 'warn' or 'error'",
+				Value:    "warn",
+				Category: "Assembly",
+			},
+			&cli.BoolFlag{
+				Name:     "write-assembly",
+				Usage:    "Add the detected assembly to the contig header lines",
+				Category: "Assembly",
+			},
+			&cli.StringFlag{
+				Name:     "error-policy",
+				Usage:    "What to do with rows that can't be converted (error, warn or drop)",
+				Value:    "error",
+				Category: "Optional",
+			},
+			&cli.StringFlag{
+				Name:     "duplicate-ids",
+				Usage:    "What to do with records that have the same ID as an earlier record (warn, error or rename)",
+				Value:    "warn",
+				Category: "Optional",
+			},
+			&cli.BoolFlag{
+				Name:     "validate",
+				Usage:    "Check the written records against the header and fail when problems are found",
+				Category: "Optional",
+			},
+			&cli.StringFlag{
+				Name:     "contig-policy",
+				Usage:    "What to do with records on unknown contigs, past the end of their contig or with END < POS: 'error', 'warn' or 'drop'",
+				Value:    "warn",
+				Category: "Optional",
+			},
+			&cli.BoolFlag{
+				Name:     "sort",
+				Usage:    "Sort the records by the contig order of the header and their position",
+				Category: "Sorting",
+			},
+			&cli.Int64Flag{
+				Name:     "sort-memory",
+				Usage:    "The amount of memory (in MB) the records can use while sorting, the records are sorted on disk when this limit is reached",
+				Value:    512,
+				Category: "Sorting",
+			},
+			&cli.StringFlag{
+				Name:     "tmp-dir",
+				Usage:    "The directory to write the temporary files to while sorting, defaults to the system temporary directory",
+				Category: "Sorting",
+			},
+			&cli.BoolFlag{
+				Name:     "assume-sorted",
+				Usage:    "Fail when the records are not sorted by the contig order of the header and their position",
+				Category: "Sorting",
+			},
+			&cli.BoolFlag{
+				Name:     "sites-only",
+				Usage:    "Leave out the FORMAT and sample columns, this is done automatically when no FORMAT fields are configured",
+				Category: "Output",
+			},
+			&cli.StringFlag{
+				Name:     "split-by",
+				Usage:    "Write one file per chromosome (chrom) or per value of an expression (e.g. $4), the output path needs a {group} placeholder",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "split-restrict-contigs",
+				Usage:    "Only add the contig header lines of the contigs in the group to each file when using --split-by",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "no-source",
+				Usage:    "Don't add the ##source header line with the version of bedgovcf",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "no-date",
+				Usage:    "Don't add the ##fileDate header line",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "no-command",
+				Usage:    "Don't add the ##bedgovcfCommand header line with the command line",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "no-reference",
+				Usage:    "Don't add the ##reference header line",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "embed-config",
+				Usage:    "Add the config and the checksums of the input files to the header, use the replay command to convert the same inputs again",
+				Category: "Output",
+			},
+			&cli.StringFlag{
+				Name:     "header-template",
+				Usage:    "A (gzipped) VCF file of which the meta lines are added to the header, the definitions of the config are kept when they are defined in both",
+				Category: "Output",
+			},
+			&cli.StringFlag{
+				Name:     "vcf-version",
+				Usage:    "The VCF version to write (4.2, 4.3 or 4.4), overrides the version in the config. Defaults to 4.2",
+				Category: "Output",
+			},
+			&cli.StringFlag{
+				Name:     "output-format",
+				Aliases:  []string{"O"},
+				Usage:    "The format of the output (vcf or bcf), defaults to bcf when the output file ends with .bcf and vcf otherwise",
+				Category: "Output",
+			},
+			&cli.BoolFlag{
+				Name:     "compress",
+				Aliases:  []string{"z"},
+				Usage:    "Compress the output with BGZF, this is done automatically when the output file ends with .gz or .bgz",
+				Category: "Output",
+			},
+			&cli.StringFlag{
+				Name:     "index",
+				Usage:    "Create an index for the compressed output file (tbi, csi or auto). 'auto' creates a CSI index when a contig is longer than 2^29 bases",
+				Category: "Output",
+			},
+			&cli.IntFlag{
+				Name:     "threads",
+				Aliases:  []string{"t"},
+				Usage:    "The amount of threads to use for the compression",
+				Value:    runtime.NumCPU(),
+				Category: "Output",
+			},
 			&cli.StringFlag{
 				Name:     "config",
 				Aliases:  []string{"c"},
 				Usage:    "Configuration file to use for the conversion in YAML format",
-				Required: true,
 				Category: "Required",
 			},
 			&cli.StringFlag{
 				Name:     "bed",
 				Aliases:  []string{"b"},
 				Usage:    "The input BED file",
-				Required: true,
 				Category: "Required",
 			},
 			&cli.StringFlag{
 				Name:     "fai",
 				Aliases:  []string{"f"},
 				Usage:    "The location to the fasta index file",
-				Required: true,
-				Category: "Required",
+				Category: "Contigs (one is required)",
+			},
+			&cli.StringFlag{
+				Name:     "dict",
+				Aliases:  []string{"d"},
+				Usage:    "The location to the sequence dictionary (.dict) of the reference",
+				Category: "Contigs (one is required)",
+			},
+			&cli.StringFlag{
+				Name:     "fasta",
+				Usage:    "The location to the fasta file of the reference, the contigs are read from its index or by scanning the file when no index is present",
+				Category: "Contigs (one is required)",
+			},
+			&cli.BoolFlag{
+				Name:     "md5",
+				Usage:    "Calculate the MD5 checksums of the contigs from the fasta file given with --fasta and add them to the contig header lines",
+				Category: "Contigs (one is required)",
+			},
+			&cli.StringFlag{
+				Name:     "assembly",
+				Aliases:  []string{"a"},
+				Usage:    "Use the contigs of a built-in assembly (GRCh37, GRCh38, T2T-CHM13 or GRCm39)",
+				Category: "Contigs (one is required)",
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:      "validate",
+				Usage:     "Check the records of a VCF file against its header",
+				ArgsUsage: "<vcf>",
+				Action: func(c *cli.Context) error {
+					logger := log.New(os.Stderr, "", 0)
+					err := bedgovcf.ValidateVcf(c)
+					if err != nil {
+						logger.Fatal(err)
+					}
+					return nil
+				},
 			},
 		},
 		Action: func(c *cli.Context) error {
 			logger := log.New(os.Stderr, "", 0)
+			// The flags are checked here so they aren't required for the subcommands
+			if c.String("config") == "" || c.String("bed") == "" {
+				logger.Fatal("the --config and --bed flags are required")
+			}
 			config, err := bedgovcf.ReadConfig(c.String("config"))
 			if err != nil {
 				logger.Fatal(err)
 			}
-			vcf := bedgovcf.Vcf{}
-			err = vcf.SetHeader(c, config)
+			err = convert(c, config)
 			if err != nil {
 				logger.Fatal(err)
 			}
-			err = vcf.AddVariants(c, config)
+
+			return nil
+		},
+	}
+
+	// The replay command accepts the same flags as the conversion, the config is read from the VCF
+	app.Commands = append(app.Commands, &cli.Command{
+		Name:      "replay",
+		Usage:     "Convert the inputs of a VCF created with --embed-config again, the inputs are checked against the checksums in the header",
+		ArgsUsage: "<vcf>",
+		Flags: slices.DeleteFunc(slices.Clone(app.Flags), func(flag cli.Flag) bool {
+			return slices.Contains(flag.Names(), "config")
+		}),
+		Action: func(c *cli.Context) error {
+			logger := log.New(os.Stderr, "", 0)
+			if c.String("bed") == "" {
+				logger.Fatal("the --bed flag is required")
+			}
+			config, err := bedgovcf.ReplayConfig(c)
 			if err != nil {
 				logger.Fatal(err)
 			}
-			err = vcf.Write(c)
+			err = convert(c, config)
 			if err != nil {
 				logger.Fatal(err)
 			}
-
 			return nil
 		},
-	}
+	})
 
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
+
+// Convert the BED file to a VCF file with the given config
+func convert(c *cli.Context, config bedgovcf.Config) error {
+	vcf := bedgovcf.Vcf{}
+	err := vcf.SetHeader(c, config)
+	if err != nil {
+		return err
+	}
+	err = vcf.AddVariants(c, config)
+	if err != nil {
+		return err
+	}
+	return vcf.Write(c)
+}
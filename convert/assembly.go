@@ -0,0 +1,205 @@
+package bedgovcf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// The struct that checks if the contigs and the data fit the same assembly
+type AssemblyCheck struct {
+	Detected     string           // The assembly detected from the contigs in the header
+	Expected     string           // The assembly the user expects
+	Policy       string           // What to do when the assemblies don't match (warn or error)
+	MaxPositions map[string]int64 // The maximum position of the data per chromosome
+	Chroms       []string         // The chromosomes of the data in the order they were found
+	fingerprints []assemblyContig // The contigs of the embedded assemblies
+}
+
+// Detect the assembly of the contigs in the header and compare it to the expected assembly
+func (h *Header) newAssemblyCheck(cCtx *cli.Context) (*AssemblyCheck, error) {
+	logger := log.New(os.Stderr, "", 0)
+
+	check := &AssemblyCheck{
+		Policy:       cCtx.String("assembly-policy"),
+		MaxPositions: map[string]int64{},
+	}
+	if check.Policy == "" {
+		check.Policy = "warn"
+	}
+	if check.Policy != "warn" && check.Policy != "error" {
+		return nil, fmt.Errorf("the assembly policy (%v) is not supported, use 'warn' or 'error'", check.Policy)
+	}
+
+	if cCtx.String("expect-assembly") != "" {
+		expected, err := assemblyName(cCtx.String("expect-assembly"))
+		if err != nil {
+			return nil, err
+		}
+		check.Expected = expected
+	}
+
+	fingerprints, err := readAssemblyContigs()
+	if err != nil {
+		return nil, err
+	}
+	check.fingerprints = fingerprints
+
+	detected, matches, total := h.detectAssembly(fingerprints)
+	check.Detected = detected
+	// The detected assembly is only reported when one of the assembly options asks for it
+	if check.Expected != "" || cCtx.Bool("write-assembly") {
+		if detected == "" {
+			logger.Printf("Could not detect the assembly of the contigs")
+		} else {
+			logger.Printf("Detected assembly %v (%v/%v primary contigs match)", detected, matches, total)
+		}
+	}
+
+	if check.Expected != "" && detected != "" && check.Expected != detected {
+		err := check.mismatch(fmt.Sprintf("the contigs match assembly %v, but %v was expected", detected, check.Expected))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if detected != "" && cCtx.Bool("write-assembly") {
+		for i, v := range h.HeaderLines {
+			if strings.ToLower(v.Category) == "contig" && v.get("assembly") == "" {
+				h.HeaderLines[i].set("assembly", detected)
+			}
+		}
+	}
+
+	return check, nil
+}
+
+// Detect the assembly by comparing the names and lengths of the contigs to the embedded assemblies
+// Returns the detected assembly, the amount of matching contigs and the amount of contigs in the assembly
+func (h *Header) detectAssembly(fingerprints []assemblyContig) (string, int, int) {
+	matches := map[string]int{}
+	totals := map[string]int{}
+	for _, fingerprint := range fingerprints {
+		totals[fingerprint.Assembly]++
+	}
+
+	for _, v := range h.HeaderLines {
+		if strings.ToLower(v.Category) != "contig" {
+			continue
+		}
+		length, err := strconv.ParseInt(v.get("length"), 10, 64)
+		if err != nil {
+			continue
+		}
+		for _, fingerprint := range fingerprints {
+			if fingerprint.Length == length && fingerprint.hasName(v.id()) {
+				matches[fingerprint.Assembly]++
+			}
+		}
+	}
+
+	// Only detect an assembly when it has more matching contigs than all others
+	detected := ""
+	tie := false
+	for _, assembly := range sortedKeys(matches) {
+		if matches[assembly] > matches[detected] {
+			detected = assembly
+			tie = false
+		} else if matches[assembly] == matches[detected] {
+			tie = true
+		}
+	}
+	if tie {
+		return "", 0, 0
+	}
+	return detected, matches[detected], totals[detected]
+}
+
+// Keep track of the maximum position of the data per chromosome
+func (ac *AssemblyCheck) observe(variant Variant) {
+	position, err := strconv.ParseInt(variant.Pos, 10, 64)
+	if err != nil {
+		return
+	}
+	for _, v := range variant.Info {
+		if strings.ToUpper(v.Name) != "END" {
+			continue
+		}
+		end, err := strconv.ParseInt(v.Value, 10, 64)
+		if err == nil && end > position {
+			position = end
+		}
+	}
+
+	if _, ok := ac.MaxPositions[variant.Chrom]; !ok {
+		ac.Chroms = append(ac.Chroms, variant.Chrom)
+	}
+	if position > ac.MaxPositions[variant.Chrom] {
+		ac.MaxPositions[variant.Chrom] = position
+	}
+}
+
+// Check if the chromosomes and maximum positions of the data fit the expected or detected assembly
+func (ac *AssemblyCheck) check() error {
+	assembly := ac.Expected
+	if assembly == "" {
+		assembly = ac.Detected
+	}
+	if assembly == "" {
+		return nil
+	}
+
+	for _, chrom := range ac.Chroms {
+		var contig *assemblyContig
+		knownElsewhere := false
+		for i, fingerprint := range ac.fingerprints {
+			if !fingerprint.hasName(chrom) {
+				continue
+			}
+			if fingerprint.Assembly == assembly {
+				contig = &ac.fingerprints[i]
+			} else {
+				knownElsewhere = true
+			}
+		}
+
+		if contig == nil && knownElsewhere {
+			err := ac.mismatch(fmt.Sprintf("the chromosome %v of the data is not part of assembly %v", chrom, assembly))
+			if err != nil {
+				return err
+			}
+		} else if contig != nil && ac.MaxPositions[chrom] > contig.Length {
+			err := ac.mismatch(fmt.Sprintf("the data contains positions up to %v on %v, but %v is only %v long in assembly %v", ac.MaxPositions[chrom], chrom, chrom, contig.Length, assembly))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Report an assembly mismatch according to the policy
+func (ac *AssemblyCheck) mismatch(message string) error {
+	if ac.Policy == "error" {
+		return errors.New("assembly mismatch: " + message)
+	}
+	logger := log.New(os.Stderr, "", 0)
+	logger.Printf("WARNING: assembly mismatch: %v", message)
+	return nil
+}
+
+// Get the keys of a map in sorted order
+func sortedKeys(input map[string]int) []string {
+	keys := []string{}
+	for key := range input {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package bedgovcf
+
+import (
+	"testing"
+)
+
+func TestDetectAssembly(t *testing.T) {
+	fingerprints, _ := readAssemblyContigs()
+
+	header := Header{}
+	addTestContigs(t, &header)
+	detected, matches, total := header.detectAssembly(fingerprints)
+	if detected != "GRCh38" || matches != 2 || total != 25 {
+		t.Fatalf("Expected GRCh38 with 2/25 matching contigs, got %s with %d/%d", detected, matches, total)
+	}
+
+	// The mitochondrial contig is the same in all human assemblies
+	header = Header{HeaderLines: []HeaderLine{newHeaderLine("contig", "ID", "chrM", "length", "16569")}}
+	detected, _, _ = header.detectAssembly(fingerprints)
+	if detected != "" {
+		t.Fatalf("Expected no assembly to be detected, got %s", detected)
+	}
+
+	header = Header{HeaderLines: []HeaderLine{newHeaderLine("contig", "ID", "1", "length", "249250621")}}
+	detected, _, _ = header.detectAssembly(fingerprints)
+	if detected != "GRCh37" {
+		t.Fatalf("Expected GRCh37 to be detected, got %s", detected)
+	}
+}
+
+func TestAssemblyCheck(t *testing.T) {
+	fingerprints, _ := readAssemblyContigs()
+	check := &AssemblyCheck{
+		Detected:     "GRCh38",
+		Policy:       "error",
+		MaxPositions: map[string]int64{},
+		fingerprints: fingerprints,
+	}
+
+	check.observe(Variant{Chrom: "chr1", Pos: "100", Info: SliceVariantInfoFormat{{Name: "end", Value: "248956000"}}})
+	if err := check.check(); err != nil {
+		t.Fatalf("Expected the data to fit GRCh38, got %v", err)
+	}
+
+	// chr1 is longer in GRCh37
+	check.observe(Variant{Chrom: "chr1", Pos: "249000000"})
+	if err := check.check(); err == nil {
+		t.Fatalf("Expected an error for positions past the end of chr1 in GRCh38")
+	}
+
+	check = &AssemblyCheck{
+		Expected:     "GRCm39",
+		Policy:       "error",
+		MaxPositions: map[string]int64{},
+		fingerprints: fingerprints,
+	}
+	check.observe(Variant{Chrom: "chr21", Pos: "100"})
+	if err := check.check(); err == nil {
+		t.Fatalf("Expected an error for chr21 in GRCm39")
+	}
+}
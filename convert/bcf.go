@@ -0,0 +1,341 @@
+package bedgovcf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The types of the typed values in a BCF file
+const (
+	bcfTypeNull  = 0
+	bcfTypeInt8  = 1
+	bcfTypeInt16 = 2
+	bcfTypeInt32 = 3
+	bcfTypeFloat = 5
+	bcfTypeChar  = 7
+)
+
+// The values that mark missing data in a BCF file
+const (
+	bcfMissingInt   = math.MinInt64 // The value used for a missing integer before it is encoded
+	bcfMissingFloat = 0x7f800001    // The bits of a missing float
+)
+
+// The struct that encodes variants to BCF records
+type BcfEncoder struct {
+	Dictionary  map[string]int    // The index of each FILTER, INFO and FORMAT ID in the string dictionary
+	Contigs     map[string]int    // The index of each contig in the contig dictionary
+	Names       []string          // The contig names in header order
+	Samples     int               // The amount of samples (0 for sites-only files)
+	InfoTypes   map[string]string // The type of each INFO field in the header
+	FormatTypes map[string]string // The type of each FORMAT field in the header
+}
+
+// Create a BCF encoder with the dictionaries of the header
+func (h *Header) newBcfEncoder() *BcfEncoder {
+	encoder := &BcfEncoder{
+		Dictionary:  map[string]int{"PASS": 0},
+		Contigs:     map[string]int{},
+		InfoTypes:   map[string]string{},
+		FormatTypes: map[string]string{},
+	}
+	if !h.SitesOnly {
+		encoder.Samples = 1
+	}
+
+	for _, v := range h.HeaderLines {
+		id := v.writtenId()
+		switch strings.ToLower(v.Category) {
+		case "contig":
+			if _, ok := encoder.Contigs[v.id()]; !ok {
+				encoder.Contigs[v.id()] = len(encoder.Names)
+				encoder.Names = append(encoder.Names, v.id())
+			}
+			continue
+		case "info":
+			encoder.InfoTypes[id] = strings.ToLower(v.get("Type"))
+		case "format":
+			encoder.FormatTypes[id] = strings.ToLower(v.get("Type"))
+		case "filter":
+		default:
+			continue
+		}
+		if _, ok := encoder.Dictionary[id]; !ok {
+			encoder.Dictionary[id] = len(encoder.Dictionary)
+		}
+	}
+	return encoder
+}
+
+// Convert the header to the binary BCF header
+// The FILTER, INFO, FORMAT and contig lines get their dictionary index as IDX attribute, the same as htslib writes them
+func (be *BcfEncoder) header(h Header) []byte {
+	// The PASS filter is always the first entry in the dictionary
+	source := h.HeaderLines
+	if !slices.ContainsFunc(source, func(v HeaderLine) bool { return strings.EqualFold(v.Category, "filter") && v.writtenId() == "PASS" }) {
+		source = append([]HeaderLine{newHeaderLine("FILTER", "ID", "PASS", "Description", "All filters passed")}, source...)
+	}
+	h.HeaderLines = []HeaderLine{}
+	for _, v := range source {
+		line := v
+		line.Attributes = slices.Clone(v.Attributes)
+		switch strings.ToLower(v.Category) {
+		case "contig":
+			line.set("IDX", strconv.Itoa(be.Contigs[v.id()]))
+		case "filter", "info", "format":
+			line.set("IDX", strconv.Itoa(be.Dictionary[v.writtenId()]))
+		}
+		h.HeaderLines = append(h.HeaderLines, line)
+	}
+	text := h.String()
+
+	data := []byte("BCF\x02\x02")
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(text)+1))
+	data = append(data, text...)
+	return append(data, 0)
+}
+
+// Convert a variant to a BCF record
+func (be *BcfEncoder) encode(v Variant) ([]byte, error) {
+	contig, ok := be.Contigs[v.Chrom]
+	if !ok {
+		return nil, fmt.Errorf("the contig %v is not present in the header, which is required for BCF output", v.Chrom)
+	}
+	beg, end, err := v.interval()
+	if err != nil {
+		return nil, err
+	}
+	qual := uint32(bcfMissingFloat)
+	if !isMissing(v.Qual) {
+		value, err := strconv.ParseFloat(v.Qual, 32)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the quality (%v) of the record at %v:%v to a float", v.Qual, v.Chrom, v.Pos)
+		}
+		qual = math.Float32bits(float32(value))
+	}
+
+	alleles := []string{v.Ref}
+	if !isMissing(v.Alt) {
+		alleles = append(alleles, strings.Split(v.Alt, ",")...)
+	}
+
+	shared := []byte{}
+	shared = binary.LittleEndian.AppendUint32(shared, uint32(contig))
+	shared = binary.LittleEndian.AppendUint32(shared, uint32(beg))
+	shared = binary.LittleEndian.AppendUint32(shared, uint32(end-beg))
+	shared = binary.LittleEndian.AppendUint32(shared, qual)
+
+	info := []byte{}
+	infoCount := 0
+	for _, field := range v.Info {
+		if isMissing(field.Value) {
+			continue
+		}
+		encoded, err := be.encodeInfo(field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the record at %v:%v: %v", v.Chrom, v.Pos, err)
+		}
+		info = append(info, encoded...)
+		infoCount++
+	}
+
+	format := []byte{}
+	for _, field := range v.Format {
+		encoded, err := be.encodeFormat(field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode the record at %v:%v: %v", v.Chrom, v.Pos, err)
+		}
+		format = append(format, encoded...)
+	}
+
+	shared = binary.LittleEndian.AppendUint32(shared, uint32(infoCount)|uint32(len(alleles))<<16)
+	shared = binary.LittleEndian.AppendUint32(shared, uint32(be.Samples)|uint32(len(v.Format))<<24)
+
+	id := v.Id
+	if isMissing(id) {
+		id = ""
+	}
+	shared = bcfTypedString(shared, id)
+	for _, allele := range alleles {
+		shared = bcfTypedString(shared, allele)
+	}
+
+	filters := []int64{}
+	if !isMissing(v.Filter) {
+		for _, filter := range strings.Split(v.Filter, ";") {
+			index, ok := be.Dictionary[strings.ToUpper(filter)]
+			if !ok {
+				return nil, fmt.Errorf("the filter %v of the record at %v:%v is not present in the header", filter, v.Chrom, v.Pos)
+			}
+			filters = append(filters, int64(index))
+		}
+	}
+	shared = bcfTypedInts(shared, filters)
+	shared = append(shared, info...)
+
+	record := []byte{}
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(shared)))
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(format)))
+	record = append(record, shared...)
+	return append(record, format...), nil
+}
+
+// Encode an INFO field as a typed key and value
+func (be *BcfEncoder) encodeInfo(field VariantInfoFormat) ([]byte, error) {
+	name := strings.ToUpper(field.Name)
+	index, ok := be.Dictionary[name]
+	if !ok {
+		return nil, fmt.Errorf("the INFO field %v is not present in the header", name)
+	}
+	data := bcfTypedInts([]byte{}, []int64{int64(index)})
+	if be.InfoTypes[name] == "flag" {
+		return append(data, bcfTypeNull), nil
+	}
+	return bcfTypedValue(data, "INFO", name, be.InfoTypes[name], field.Value)
+}
+
+// Encode a FORMAT field of the sample as a typed key and value
+func (be *BcfEncoder) encodeFormat(field VariantInfoFormat) ([]byte, error) {
+	name := strings.ToUpper(field.Name)
+	index, ok := be.Dictionary[name]
+	if !ok {
+		return nil, fmt.Errorf("the FORMAT field %v is not present in the header", name)
+	}
+	data := bcfTypedInts([]byte{}, []int64{int64(index)})
+	value := field.Value
+	if isMissing(value) {
+		value = "."
+	}
+	if name == "GT" {
+		genotype, err := bcfGenotype(value)
+		if err != nil {
+			return nil, err
+		}
+		return bcfTypedInts(data, genotype), nil
+	}
+	return bcfTypedValue(data, "FORMAT", name, be.FormatTypes[name], value)
+}
+
+// Encode a comma separated value according to its header type
+func bcfTypedValue(data []byte, category string, name string, valueType string, value string) ([]byte, error) {
+	switch valueType {
+	case "integer":
+		values := []int64{}
+		for _, v := range strings.Split(value, ",") {
+			if isMissing(v) {
+				values = append(values, bcfMissingInt)
+				continue
+			}
+			parsed, err := strconv.ParseInt(v, 10, 32)
+			if err != nil || parsed <= math.MinInt32+7 {
+				return nil, fmt.Errorf("the value (%v) of %v/%v can't be encoded as an integer", v, category, name)
+			}
+			values = append(values, parsed)
+		}
+		return bcfTypedInts(data, values), nil
+	case "float":
+		values := []uint32{}
+		for _, v := range strings.Split(value, ",") {
+			if isMissing(v) {
+				values = append(values, bcfMissingFloat)
+				continue
+			}
+			parsed, err := strconv.ParseFloat(v, 32)
+			if err != nil {
+				return nil, fmt.Errorf("the value (%v) of %v/%v can't be encoded as a float", v, category, name)
+			}
+			values = append(values, math.Float32bits(float32(parsed)))
+		}
+		data = bcfTypeDescriptor(data, len(values), bcfTypeFloat)
+		for _, v := range values {
+			data = binary.LittleEndian.AppendUint32(data, v)
+		}
+		return data, nil
+	}
+	return bcfTypedString(data, value), nil
+}
+
+// Encode a genotype (e.g. 0/1 or 1|0) as BCF integers
+func bcfGenotype(value string) ([]int64, error) {
+	genotype := []int64{}
+	phased := int64(0)
+	start := 0
+	for i := 0; i <= len(value); i++ {
+		if i < len(value) && value[i] != '/' && value[i] != '|' {
+			continue
+		}
+		allele := value[start:i]
+		encoded := int64(0)
+		if allele != "." {
+			index, err := strconv.ParseInt(allele, 10, 32)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("the genotype (%v) is not valid", value)
+			}
+			encoded = (index + 1) << 1
+		}
+		genotype = append(genotype, encoded|phased)
+		if i < len(value) && value[i] == '|' {
+			phased = 1
+		} else {
+			phased = 0
+		}
+		start = i + 1
+	}
+	return genotype, nil
+}
+
+// Append the type descriptor of a typed value, the count is written as a separate typed integer when it is 15 or more
+func bcfTypeDescriptor(data []byte, count int, valueType byte) []byte {
+	if count < 15 {
+		return append(data, byte(count)<<4|valueType)
+	}
+	data = append(data, 15<<4|valueType)
+	return bcfTypedInts(data, []int64{int64(count)})
+}
+
+// Append a string as a typed character vector
+func bcfTypedString(data []byte, value string) []byte {
+	data = bcfTypeDescriptor(data, len(value), bcfTypeChar)
+	return append(data, value...)
+}
+
+// Append integers as a typed vector using the smallest type that fits all values
+func bcfTypedInts(data []byte, values []int64) []byte {
+	valueType := byte(bcfTypeInt8)
+	for _, v := range values {
+		if v == bcfMissingInt {
+			continue
+		}
+		if v < math.MinInt16+8 || v > math.MaxInt16 {
+			valueType = bcfTypeInt32
+		} else if (v < math.MinInt8+8 || v > math.MaxInt8) && valueType == bcfTypeInt8 {
+			valueType = bcfTypeInt16
+		}
+	}
+
+	data = bcfTypeDescriptor(data, len(values), valueType)
+	for _, v := range values {
+		switch valueType {
+		case bcfTypeInt8:
+			if v == bcfMissingInt {
+				v = math.MinInt8
+			}
+			data = append(data, byte(int8(v)))
+		case bcfTypeInt16:
+			if v == bcfMissingInt {
+				v = math.MinInt16
+			}
+			data = binary.LittleEndian.AppendUint16(data, uint16(int16(v)))
+		case bcfTypeInt32:
+			if v == bcfMissingInt {
+				v = math.MinInt32
+			}
+			data = binary.LittleEndian.AppendUint32(data, uint32(int32(v)))
+		}
+	}
+	return data
+}
@@ -0,0 +1,236 @@
+package bedgovcf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBcfTypedInts(t *testing.T) {
+	tests := []struct {
+		values   []int64
+		expected []byte
+	}{
+		{[]int64{1, 2}, []byte{0x21, 0x01, 0x02}},
+		{[]int64{bcfMissingInt}, []byte{0x11, 0x80}},
+		{[]int64{300}, []byte{0x12, 0x2c, 0x01}},
+		{[]int64{-120, 70000}, []byte{0x23, 0x88, 0xff, 0xff, 0xff, 0x70, 0x11, 0x01, 0x00}},
+		{[]int64{}, []byte{0x01}},
+	}
+	for _, test := range tests {
+		data := bcfTypedInts([]byte{}, test.values)
+		if !bytes.Equal(data, test.expected) {
+			t.Fatalf("Expected %x for %v, got %x", test.expected, test.values, data)
+		}
+	}
+
+	// Counts of 15 or more are written as a separate typed integer
+	data := bcfTypedString([]byte{}, strings.Repeat("A", 20))
+	if !bytes.Equal(data[:3], []byte{0xf7, 0x11, 20}) {
+		t.Fatalf("Expected the descriptor f71114, got %x", data[:3])
+	}
+}
+
+func TestBcfGenotype(t *testing.T) {
+	tests := map[string][]int64{
+		"0/1": {2, 4},
+		"0|1": {2, 5},
+		"./.": {0, 0},
+		"1":   {4},
+		"1|2": {4, 7},
+	}
+	for input, expected := range tests {
+		genotype, err := bcfGenotype(input)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !slices.Equal(genotype, expected) {
+			t.Fatalf("Expected %v for %v, got %v", expected, input, genotype)
+		}
+	}
+
+	if _, err := bcfGenotype("0/a"); err == nil {
+		t.Fatalf("Expected an error for an invalid genotype")
+	}
+}
+
+func TestBcfEncode(t *testing.T) {
+	header := Header{
+		Version: "4.2",
+		Sample:  "test",
+		HeaderLines: []HeaderLine{
+			newHeaderLine("FILTER", "ID", "LowQual", "Description", "Low quality"),
+			newHeaderLine("INFO", "ID", "END", "Number", "1", "Type", "Integer"),
+			newHeaderLine("INFO", "ID", "IMPRECISE", "Number", "0", "Type", "Flag"),
+			newHeaderLine("INFO", "ID", "RATIO", "Number", "1", "Type", "Float"),
+			newHeaderLine("FORMAT", "ID", "GT", "Number", "1", "Type", "String"),
+			newHeaderLine("FORMAT", "ID", "CN", "Number", "1", "Type", "Integer"),
+			newHeaderLine("contig", "ID", "chr1", "length", "1000"),
+			newHeaderLine("contig", "ID", "chr2", "length", "1000"),
+		},
+	}
+	encoder := header.newBcfEncoder()
+
+	expectedDictionary := map[string]int{"PASS": 0, "LOWQUAL": 1, "END": 2, "IMPRECISE": 3, "RATIO": 4, "GT": 5, "CN": 6}
+	for id, index := range expectedDictionary {
+		if encoder.Dictionary[id] != index {
+			t.Fatalf("Expected %v at index %v of the dictionary, got %v", id, index, encoder.Dictionary[id])
+		}
+	}
+	if !slices.Equal(encoder.Names, []string{"chr1", "chr2"}) {
+		t.Fatalf("Expected the contigs chr1,chr2, got %v", encoder.Names)
+	}
+
+	headerData := encoder.header(header)
+	if string(headerData[:5]) != "BCF\x02\x02" {
+		t.Fatalf("Expected the BCF magic, got %q", headerData[:5])
+	}
+	text := string(headerData[9:])
+	if int(binary.LittleEndian.Uint32(headerData[5:])) != len(text) || !strings.HasSuffix(text, "\x00") {
+		t.Fatalf("Expected the header length to include the NUL terminator")
+	}
+	if !strings.HasPrefix(text, "##fileformat=VCFv4.2\n##FILTER=<ID=PASS,Description=\"All filters passed\",IDX=0>\n") {
+		t.Fatalf("Expected the PASS filter after the fileformat line, got %q", text)
+	}
+	for _, line := range []string{"##INFO=<ID=END,Number=1,Type=Integer,IDX=2>\n", "##contig=<ID=chr2,length=1000,IDX=1>\n"} {
+		if !strings.Contains(text, line) {
+			t.Fatalf("Expected the header line %q with its dictionary index, got %q", line, text)
+		}
+	}
+	if len(header.HeaderLines[0].Attributes) != 2 {
+		t.Fatalf("Expected the IDX attributes to leave the header unchanged, got %v", header.HeaderLines[0])
+	}
+
+	variant := Variant{
+		Chrom:  "chr2",
+		Pos:    "11",
+		Id:     "test_0",
+		Ref:    "N",
+		Alt:    "<DEL>",
+		Qual:   ".",
+		Filter: "LowQual",
+		Info: SliceVariantInfoFormat{
+			{Name: "END", Type: "Integer", Value: "20"},
+			{Name: "IMPRECISE", Type: "Flag", Value: "true"},
+			{Name: "RATIO", Type: "Float", Value: "."},
+		},
+		Format: SliceVariantInfoFormat{
+			{Name: "GT", Type: "String", Value: "0/1"},
+			{Name: "CN", Type: "Integer", Value: "3"},
+		},
+	}
+	record, err := encoder.encode(variant)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	sharedLength := binary.LittleEndian.Uint32(record)
+	indivLength := binary.LittleEndian.Uint32(record[4:])
+	if int(8+sharedLength+indivLength) != len(record) {
+		t.Fatalf("Expected the record lengths to add up to %v, got %v+%v", len(record)-8, sharedLength, indivLength)
+	}
+
+	shared := record[8 : 8+sharedLength]
+	fields := []uint32{}
+	for i := 0; i < 6; i++ {
+		fields = append(fields, binary.LittleEndian.Uint32(shared[i*4:]))
+	}
+	// chrom, pos (0-based), rlen (END - POS + 1), qual (missing), n_info | n_allele << 16, n_sample | n_fmt << 24
+	expected := []uint32{1, 10, 10, bcfMissingFloat, 2 | 2<<16, 1 | 2<<24}
+	if !slices.Equal(fields, expected) {
+		t.Fatalf("Expected the fixed fields %v, got %v", expected, fields)
+	}
+
+	variable := shared[24:]
+	expectedVariable := []byte{0x67, 't', 'e', 's', 't', '_', '0', 0x17, 'N', 0x57, '<', 'D', 'E', 'L', '>', 0x11, 0x01, 0x11, 0x02, 0x11, 20, 0x11, 0x03, 0x00}
+	if !bytes.Equal(variable, expectedVariable) {
+		t.Fatalf("Expected the shared data %x, got %x", expectedVariable, variable)
+	}
+
+	indiv := record[8+sharedLength:]
+	expectedIndiv := []byte{0x11, 0x05, 0x21, 0x02, 0x04, 0x11, 0x06, 0x11, 0x03}
+	if !bytes.Equal(indiv, expectedIndiv) {
+		t.Fatalf("Expected the sample data %x, got %x", expectedIndiv, indiv)
+	}
+
+	variant.Qual = "12.5"
+	record, _ = encoder.encode(variant)
+	if qual := math.Float32frombits(binary.LittleEndian.Uint32(record[20:])); qual != 12.5 {
+		t.Fatalf("Expected a quality of 12.5, got %v", qual)
+	}
+
+	variant.Chrom = "chr3"
+	if _, err := encoder.encode(variant); err == nil {
+		t.Fatalf("Expected an error for a contig that is not in the header")
+	}
+}
+
+func TestBcfPassFilter(t *testing.T) {
+	// A PASS filter of the config is written in uppercase, so no second PASS line is added
+	header := Header{Version: "4.2", SitesOnly: true, HeaderLines: []HeaderLine{newHeaderLine("FILTER", "ID", "pass", "Description", "Passed")}}
+	text := string(header.newBcfEncoder().header(header))
+	if strings.Count(text, "ID=PASS") != 1 || !strings.Contains(text, `##FILTER=<ID=PASS,Description="Passed",IDX=0>`) {
+		t.Fatalf("Expected one PASS filter, got %q", text)
+	}
+}
+
+func TestBcfHtslibFixture(t *testing.T) {
+	reader, err := gzip.NewReader(bytes.NewReader(readHtslibFixture(t, "index.bcf")))
+	if err != nil {
+		t.Fatalf("Expected the BCF file to be BGZF compressed, got %v", err)
+	}
+	expected, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	vcf, err := openVcf("../test_data/htslib/index.vcf")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer vcf.Close()
+	encoder := vcf.Header.newBcfEncoder()
+
+	headerData := encoder.header(vcf.Header)
+	if !bytes.HasPrefix(expected, headerData) {
+		length := int(binary.LittleEndian.Uint32(expected[5:])) + 9
+		t.Fatalf("Expected the header of bcftools\n%q\ngot\n%q", expected[:min(length, len(expected))], headerData)
+	}
+	expected = expected[len(headerData):]
+
+	for {
+		variant, ok, err := vcf.next()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if !ok {
+			break
+		}
+		// Flags are converted to true
+		for i, info := range variant.Info {
+			if info.Value == "" {
+				variant.Info[i].Value = "true"
+			}
+		}
+		record, err := encoder.encode(variant)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(expected) < 8 {
+			t.Fatalf("Expected a bcftools record for %v:%v", variant.Chrom, variant.Pos)
+		}
+		length := 8 + int(binary.LittleEndian.Uint32(expected)) + int(binary.LittleEndian.Uint32(expected[4:]))
+		if !bytes.Equal(record, expected[:length]) {
+			t.Fatalf("Expected the record of bcftools for %v:%v\n%x\ngot\n%x", variant.Chrom, variant.Pos, expected[:length], record)
+		}
+		expected = expected[length:]
+	}
+	if len(expected) != 0 {
+		t.Fatalf("Expected no more bcftools records, got %v bytes", len(expected))
+	}
+}
@@ -0,0 +1,182 @@
+package bedgovcf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The maximum amount of uncompressed bytes in one BGZF block (the same as htslib)
+const bgzfBlockSize = 0xff00
+
+// The empty block that marks the end of a BGZF file
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+	0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// A position in a BGZF file before the compressed offsets are known
+type bgzfPosition struct {
+	Block  int // The index of the block
+	Offset int // The offset in the uncompressed block
+}
+
+// The compressed data of one BGZF block
+type bgzfResult struct {
+	data []byte
+	err  error
+}
+
+// The struct that writes BGZF compressed data, blocks are compressed in parallel and written in order
+type BgzfWriter struct {
+	Offsets []int64 // The compressed offset of every written block (only complete after Close)
+	Sizes   []int   // The uncompressed size of every block
+	output  io.Writer
+	buffer  []byte
+	blocks  int
+	queue   chan chan bgzfResult
+	workers chan struct{}
+	done    chan struct{}
+	err     error
+	closed  bool
+}
+
+// Create a BGZF writer that compresses with the given amount of threads
+func newBgzfWriter(output io.Writer, threads int) *BgzfWriter {
+	if threads < 1 {
+		threads = 1
+	}
+	writer := &BgzfWriter{
+		Offsets: []int64{0},
+		output:  output,
+		buffer:  make([]byte, 0, bgzfBlockSize),
+		queue:   make(chan chan bgzfResult, threads*4),
+		workers: make(chan struct{}, threads),
+		done:    make(chan struct{}),
+	}
+	go writer.writeBlocks()
+	return writer
+}
+
+// Write the compressed blocks to the output in the order they were queued
+func (bw *BgzfWriter) writeBlocks() {
+	defer close(bw.done)
+	for result := range bw.queue {
+		block := <-result
+		if bw.err != nil {
+			continue
+		}
+		if block.err != nil {
+			bw.err = block.err
+			continue
+		}
+		if _, err := bw.output.Write(block.data); err != nil {
+			bw.err = fmt.Errorf("failed to write a BGZF block: %v", err)
+			continue
+		}
+		bw.Offsets = append(bw.Offsets, bw.Offsets[len(bw.Offsets)-1]+int64(len(block.data)))
+	}
+}
+
+// Write uncompressed data to the BGZF file
+func (bw *BgzfWriter) Write(data []byte) (int, error) {
+	if bw.closed {
+		return 0, errors.New("the BGZF writer is already closed")
+	}
+	written := 0
+	for len(data) != 0 {
+		size := min(len(data), bgzfBlockSize-len(bw.buffer))
+		bw.buffer = append(bw.buffer, data[:size]...)
+		data = data[size:]
+		written += size
+		if len(bw.buffer) == bgzfBlockSize {
+			bw.flush()
+		}
+	}
+	return written, nil
+}
+
+// The current position in the BGZF file
+func (bw *BgzfWriter) position() bgzfPosition {
+	return bgzfPosition{Block: bw.blocks, Offset: len(bw.buffer)}
+}
+
+// Convert a position to a virtual offset, only valid after Close
+// The end of a block is the start of the next block, the same as htslib reports it when reading the file
+func (bw *BgzfWriter) virtualOffset(position bgzfPosition) uint64 {
+	if position.Block < len(bw.Sizes) && position.Offset == bw.Sizes[position.Block] {
+		return uint64(bw.Offsets[position.Block+1]) << 16
+	}
+	return uint64(bw.Offsets[position.Block])<<16 | uint64(position.Offset)
+}
+
+// Compress the current block in the background
+func (bw *BgzfWriter) flush() {
+	if len(bw.buffer) == 0 {
+		return
+	}
+	data := bw.buffer
+	bw.buffer = make([]byte, 0, bgzfBlockSize)
+	bw.blocks++
+	bw.Sizes = append(bw.Sizes, len(data))
+
+	result := make(chan bgzfResult, 1)
+	bw.queue <- result
+	bw.workers <- struct{}{}
+	go func() {
+		compressed, err := compressBgzfBlock(data)
+		<-bw.workers
+		result <- bgzfResult{data: compressed, err: err}
+	}()
+}
+
+// Flush the remaining data, wait for all blocks to be written and write the EOF marker
+func (bw *BgzfWriter) Close() error {
+	if bw.closed {
+		return bw.err
+	}
+	bw.flush()
+	bw.closed = true
+	close(bw.queue)
+	<-bw.done
+	if bw.err != nil {
+		return bw.err
+	}
+	if _, err := bw.output.Write(bgzfEOF); err != nil {
+		return fmt.Errorf("failed to write the BGZF EOF marker: %v", err)
+	}
+	return nil
+}
+
+// Compress one block of data to a BGZF block
+func compressBgzfBlock(data []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	compressor, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the compressor: %v", err)
+	}
+	if _, err := compressor.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress a BGZF block: %v", err)
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress a BGZF block: %v", err)
+	}
+
+	// 18 bytes of header and 8 bytes of footer
+	blockSize := compressed.Len() + 26
+	if blockSize > 0x10000 {
+		return nil, fmt.Errorf("the compressed BGZF block is too large (%v bytes)", blockSize)
+	}
+
+	block := make([]byte, 0, blockSize)
+	block = append(block, 0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00)
+	block = binary.LittleEndian.AppendUint16(block, uint16(blockSize-1))
+	block = append(block, compressed.Bytes()...)
+	block = binary.LittleEndian.AppendUint32(block, crc32.ChecksumIEEE(data))
+	block = binary.LittleEndian.AppendUint32(block, uint32(len(data)))
+	return block, nil
+}
@@ -0,0 +1,179 @@
+package bedgovcf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Get the decompressed data starting at a virtual offset
+func readAtVirtualOffset(blocks map[uint64][]byte, offsets []uint64, offset uint64) string {
+	data := ""
+	for _, v := range offsets {
+		if v == offset>>16 {
+			data = string(blocks[v][offset&0xffff:])
+		} else if v > offset>>16 {
+			data += string(blocks[v])
+		}
+	}
+	return data
+}
+
+// Split a BGZF file into its decompressed blocks, indexed by their compressed offset
+func readBgzfBlocks(t *testing.T, data []byte) (map[uint64][]byte, []uint64) {
+	blocks := map[uint64][]byte{}
+	offsets := []uint64{}
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 18 || data[offset+12] != 'B' || data[offset+13] != 'C' {
+			t.Fatalf("Expected a BGZF block at offset %v", offset)
+		}
+		size := int(binary.LittleEndian.Uint16(data[offset+16:])) + 1
+		reader, err := gzip.NewReader(bytes.NewReader(data[offset : offset+size]))
+		if err != nil {
+			t.Fatalf("Expected a valid gzip block at offset %v, got %v", offset, err)
+		}
+		reader.Multistream(false)
+		block, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Expected a valid gzip block at offset %v, got %v", offset, err)
+		}
+		blocks[uint64(offset)] = block
+		offsets = append(offsets, uint64(offset))
+		offset += size
+	}
+	return blocks, offsets
+}
+
+func TestBgzfWriter(t *testing.T) {
+	input := strings.Repeat("chr1\t100\t.\tA\tT\t.\tPASS\t.\n", 10000)
+
+	var output bytes.Buffer
+	writer := newBgzfWriter(&output, 4)
+	for _, line := range strings.SplitAfter(input, "\n") {
+		if _, err := writer.Write([]byte(line)); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data := output.Bytes()
+	if !bytes.HasSuffix(data, bgzfEOF) {
+		t.Fatalf("Expected the output to end with the BGZF EOF block")
+	}
+
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(decompressed) != input {
+		t.Fatalf("Expected the decompressed output to match the input")
+	}
+
+	blocks, offsets := readBgzfBlocks(t, data)
+	if len(offsets) != len(writer.Offsets) {
+		t.Fatalf("Expected %v blocks (including EOF), got %v", len(writer.Offsets), len(offsets))
+	}
+	for i, offset := range offsets[:len(offsets)-1] {
+		if uint64(writer.Offsets[i]) != offset {
+			t.Fatalf("Expected block %v at offset %v, got %v", i, offset, writer.Offsets[i])
+		}
+		if len(blocks[offset]) > bgzfBlockSize {
+			t.Fatalf("Expected blocks of at most %v bytes, got %v", bgzfBlockSize, len(blocks[offset]))
+		}
+	}
+}
+
+func TestBgzfVirtualOffset(t *testing.T) {
+	var output bytes.Buffer
+	writer := newBgzfWriter(&output, 2)
+	positions := []bgzfPosition{}
+	for i := 0; i < 5000; i++ {
+		positions = append(positions, writer.position())
+		fmt.Fprintf(writer, "chr1\t%v\t.\tA\tT\t.\tPASS\t.\n", i+1)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	blocks, offsets := readBgzfBlocks(t, output.Bytes())
+	for i, position := range positions {
+		data := readAtVirtualOffset(blocks, offsets, writer.virtualOffset(position))
+		expected := fmt.Sprintf("chr1\t%v\t", i+1)
+		if !strings.HasPrefix(data, expected) {
+			t.Fatalf("Expected the virtual offset of record %v to point to %q", i+1, expected)
+		}
+	}
+}
+
+func TestBgzfVirtualOffsetBlockEnd(t *testing.T) {
+	var output bytes.Buffer
+	writer := newBgzfWriter(&output, 1)
+	fmt.Fprint(writer, "chr1\t1\t.\tA\tT\t.\tPASS\t.\n")
+	end := writer.position()
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The end of the last block points to the EOF block like in htslib
+	expected := uint64(output.Len()-len(bgzfEOF)) << 16
+	if offset := writer.virtualOffset(end); offset != expected {
+		t.Fatalf("Expected the virtual offset %v, got %v", expected, offset)
+	}
+}
+
+func TestBgzfHtslibFixture(t *testing.T) {
+	data := readHtslibFixture(t, "index.vcf.gz")
+	input, err := os.ReadFile("../test_data/htslib/index.vcf")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var output bytes.Buffer
+	writer := newBgzfWriter(&output, 1)
+	writer.Write(input)
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The compressed data can differ, the framing and the decompressed data can't
+	for name, file := range map[string][]byte{"bgzip": data, "bedgovcf": output.Bytes()} {
+		if !bytes.HasSuffix(file, bgzfEOF) {
+			t.Fatalf("Expected the %v file to end with the BGZF EOF marker", name)
+		}
+		blocks, offsets := readBgzfBlocks(t, file)
+		decompressed := []byte{}
+		for _, offset := range offsets {
+			if !bytes.Equal(file[offset:offset+16], bgzfEOF[:16]) {
+				t.Fatalf("Expected the %v block at %v to have the htslib header, got %x", name, offset, file[offset:offset+16])
+			}
+			decompressed = append(decompressed, blocks[offset]...)
+		}
+		if !bytes.Equal(decompressed, input) {
+			t.Fatalf("Expected the %v file to decompress to the input", name)
+		}
+	}
+}
+
+// Read a fixture that is created by test_data/htslib/make_fixtures.sh
+// The test is skipped when the fixture is missing, unless BEDGOVCF_HTSLIB_FIXTURES is set (like in CI)
+func readHtslibFixture(t *testing.T, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("../test_data/htslib", name))
+	if os.IsNotExist(err) && os.Getenv("BEDGOVCF_HTSLIB_FIXTURES") == "" {
+		t.Skip("the htslib fixtures are missing, run test_data/htslib/make_fixtures.sh to create them")
+	} else if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return data
+}
@@ -0,0 +1,210 @@
+package bedgovcf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The chromosome naming conventions that can be converted between
+var chromConventions = []string{"ucsc", "ensembl", "refseq"}
+
+// The struct for one contig of an embedded assembly with all its names
+type assemblyContig struct {
+	Assembly string            // The assembly the contig belongs to
+	Length   int64             // The length of the contig
+	Names    map[string]string // The name of the contig per naming convention
+}
+
+// The name and length of a contig, used to find the translation of a contig from a specific assembly
+type sizedContig struct {
+	Name   string // The name of the contig
+	Length int64  // The length of the contig
+}
+
+// The struct that translates chromosome names
+type ChromMapper struct {
+	Names        map[string]string      // The chromosome names to translate and their translation
+	Convention   string                 // The naming convention to translate to (ucsc, ensembl or refseq)
+	translations map[string][]string    // The translations of every name in the embedded assemblies
+	sized        map[sizedContig]string // The translations of every name and length in the embedded assemblies
+	unmapped     map[string]bool        // The names that couldn't be translated
+}
+
+// Create a chromosome mapper from a mapping file and/or a naming convention, returns nil when neither is given
+func newChromMapper(mapFile string, convention string) (*ChromMapper, error) {
+	if mapFile == "" && convention == "" {
+		return nil, nil
+	}
+
+	mapper := &ChromMapper{
+		Names:        map[string]string{},
+		Convention:   strings.ToLower(convention),
+		translations: map[string][]string{},
+		sized:        map[sizedContig]string{},
+		unmapped:     map[string]bool{},
+	}
+
+	if mapFile != "" {
+		err := mapper.readMapFile(mapFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if mapper.Convention != "" {
+		if !slices.Contains(chromConventions, mapper.Convention) {
+			return nil, fmt.Errorf("the chromosome naming convention (%v) is not supported, use one of %v", convention, strings.Join(chromConventions, ", "))
+		}
+		aliases, err := readAssemblyContigs()
+		if err != nil {
+			return nil, err
+		}
+		mapper.addAliases(aliases)
+	}
+
+	return mapper, nil
+}
+
+// Read a mapping file with two columns: the name to translate and its translation
+func (cm *ChromMapper) readMapFile(mapFile string) error {
+	file, err := os.Open(mapFile)
+	if err != nil {
+		return fmt.Errorf("failed to open the chromosome map: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.Fields(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line[0], "#") {
+			continue
+		}
+		if len(line) != 2 {
+			return &ConversionError{File: mapFile, Line: lineNumber, Err: fmt.Errorf("expected 2 columns in the chromosome map, got %v", len(line))}
+		}
+		cm.Names[line[0]] = line[1]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the chromosome map: %v", err)
+	}
+	return nil
+}
+
+// Read the names of all contigs in the embedded assemblies
+func readAssemblyContigs() ([]assemblyContig, error) {
+	contigs := []assemblyContig{}
+	for name := range assemblyAliases {
+		table, err := assemblyTables.ReadFile(fmt.Sprintf("assemblies/%v.tsv", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the embedded assembly %v: %v", name, err)
+		}
+		for _, v := range strings.Split(string(table), "\n") {
+			if v == "" || strings.HasPrefix(v, "#") {
+				continue
+			}
+			line := strings.Split(v, "\t")
+			length, err := strconv.ParseInt(line[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse the contig length (%v) of the embedded assembly %v", line[1], name)
+			}
+			contigs = append(contigs, assemblyContig{
+				Assembly: name,
+				Length:   length,
+				Names: map[string]string{
+					"ucsc":    line[0],
+					"ensembl": line[2],
+					"refseq":  line[3],
+				},
+			})
+		}
+	}
+	return contigs, nil
+}
+
+// Build the lookup tables of the names of the contigs in the embedded assemblies
+func (cm *ChromMapper) addAliases(aliases []assemblyContig) {
+	for _, v := range aliases {
+		translation := v.Names[cm.Convention]
+		for _, name := range v.Names {
+			if !slices.Contains(cm.translations[name], translation) {
+				cm.translations[name] = append(cm.translations[name], translation)
+			}
+			key := sizedContig{Name: name, Length: v.Length}
+			if _, ok := cm.sized[key]; !ok {
+				cm.sized[key] = translation
+			}
+		}
+	}
+}
+
+// Translate the name of a contig with a known length
+// The length is used to choose the right assembly when the translation depends on it (e.g. RefSeq accessions)
+func (cm *ChromMapper) mapContig(name string, length int64) (string, bool) {
+	if translation, ok := cm.Names[name]; ok {
+		return translation, true
+	}
+
+	if translation, ok := cm.sized[sizedContig{Name: name, Length: length}]; ok {
+		cm.Names[name] = translation
+		return translation, true
+	}
+
+	return cm.mapChrom(name)
+}
+
+// Translate a chromosome name, returns false when the name can't be translated
+func (cm *ChromMapper) mapChrom(name string) (string, bool) {
+	if translation, ok := cm.Names[name]; ok {
+		return translation, true
+	}
+	if cm.unmapped[name] {
+		return name, false
+	}
+
+	// Names with more than one translation (e.g. RefSeq accessions without a length) can't be translated
+	translations := cm.translations[name]
+	if len(translations) != 1 {
+		cm.unmapped[name] = true
+		return name, false
+	}
+
+	cm.Names[name] = translations[0]
+	return translations[0], true
+}
+
+// Check if a name is one of the names of an assembly contig
+func (ac assemblyContig) hasName(name string) bool {
+	for _, v := range ac.Names {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate the names of the contig header lines, returns the names that couldn't be translated
+func (h *Header) mapContigs(mapper *ChromMapper) []string {
+	unmapped := []string{}
+	for i, v := range h.HeaderLines {
+		if strings.ToLower(v.Category) != "contig" {
+			continue
+		}
+		length, err := strconv.ParseInt(v.get("length"), 10, 64)
+		if err != nil {
+			length = -1
+		}
+		name, ok := mapper.mapContig(v.id(), length)
+		if !ok {
+			unmapped = append(unmapped, v.id())
+		}
+		h.HeaderLines[i].set("ID", name)
+	}
+	return unmapped
+}
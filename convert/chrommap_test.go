@@ -0,0 +1,75 @@
+package bedgovcf
+
+import (
+	"testing"
+)
+
+func TestChromMapperConvention(t *testing.T) {
+	mapper, err := newChromMapper("", "ensembl")
+	if err != nil {
+		t.Fatalf("Failed to create the chromosome mapper: %v", err)
+	}
+
+	name, ok := mapper.mapChrom("chr1")
+	if !ok || name != "1" {
+		t.Fatalf("Expected chr1 to be translated to 1, got %s", name)
+	}
+
+	name, ok = mapper.mapChrom("chrM")
+	if !ok || name != "MT" {
+		t.Fatalf("Expected chrM to be translated to MT, got %s", name)
+	}
+
+	name, ok = mapper.mapChrom("chrUn_KI270302v1")
+	if ok || name != "chrUn_KI270302v1" {
+		t.Fatalf("Expected chrUn_KI270302v1 not to be translated, got %s", name)
+	}
+	if !mapper.unmapped["chrUn_KI270302v1"] {
+		t.Fatalf("Expected chrUn_KI270302v1 to be remembered as a name that can't be translated")
+	}
+
+	_, err = newChromMapper("", "gencode")
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported naming convention")
+	}
+}
+
+func TestChromMapperRefseq(t *testing.T) {
+	mapper, _ := newChromMapper("", "refseq")
+
+	// The RefSeq accession depends on the assembly, so it can only be found for contigs with a known length
+	_, ok := mapper.mapChrom("chr1")
+	if ok {
+		t.Fatalf("Expected chr1 not to be translated without a contig length")
+	}
+
+	header := Header{}
+	addTestContigs(t, &header)
+	unmapped := header.mapContigs(mapper)
+	if len(unmapped) != 0 {
+		t.Fatalf("Expected all contigs to be translated, got %v unmapped", unmapped)
+	}
+	if header.HeaderLines[0].id() != "NC_000001.11" || header.HeaderLines[1].id() != "NC_000002.12" {
+		t.Fatalf("Expected the contigs to be translated to GRCh38 accessions, got %v", header.HeaderLines)
+	}
+
+	name, ok := mapper.mapChrom("chr1")
+	if !ok || name != "NC_000001.11" {
+		t.Fatalf("Expected chr1 to be translated to NC_000001.11 after reading the header, got %s", name)
+	}
+}
+
+func TestChromMapperFile(t *testing.T) {
+	mapper, err := newChromMapper("../test_data/test.chrommap", "")
+	if err != nil {
+		t.Fatalf("Failed to read the chromosome map: %v", err)
+	}
+	name, ok := mapper.mapChrom("chr1")
+	if !ok || name != "1" {
+		t.Fatalf("Expected chr1 to be translated to 1, got %s", name)
+	}
+	_, ok = mapper.mapChrom("chrX")
+	if ok {
+		t.Fatalf("Expected chrX not to be translated")
+	}
+}
@@ -0,0 +1,86 @@
+package bedgovcf
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Convert a resolved value to the declared type of its field
+// Every comma separated value is converted separately, missing values (.) are kept
+func coerceValue(value string, valueType string, rounding string) (string, error) {
+	valueType = strings.ToLower(valueType)
+	if isMissing(value) || !slices.Contains([]string{"integer", "float", "character"}, valueType) {
+		return value, nil
+	}
+
+	values := strings.Split(value, ",")
+	for i, v := range values {
+		if v == "." {
+			continue
+		}
+		var err error
+		switch valueType {
+		case "integer":
+			values[i], err = coerceInteger(v, rounding)
+		case "float":
+			values[i], err = coerceFloat(v)
+		case "character":
+			if len([]rune(v)) != 1 {
+				err = fmt.Errorf("the value (%v) is not a single character", v)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.Join(values, ","), nil
+}
+
+// Convert a value to a 32-bit integer, floats are rounded or truncated according to the rounding policy
+func coerceInteger(value string, rounding string) (string, error) {
+	float, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(float) || math.IsInf(float, 0) {
+		return "", fmt.Errorf("the value (%v) can't be converted to an integer", value)
+	}
+	if float != math.Trunc(float) {
+		switch rounding {
+		case "truncate":
+			float = math.Trunc(float)
+		case "error":
+			return "", fmt.Errorf("the value (%v) is not an integer", value)
+		default:
+			float = math.Round(float)
+		}
+	}
+	if float > math.MaxInt32 || float < math.MinInt32 {
+		return "", fmt.Errorf("the value (%v) is too large for an integer", value)
+	}
+	if float == 0 {
+		// Avoid writing -0
+		float = 0
+	}
+	return strconv.FormatFloat(float, 'f', 0, 64), nil
+}
+
+// Convert a value to a float with a normalised notation (e.g. 1.50 -> 1.5, 1e3 -> 1000)
+func coerceFloat(value string) (string, error) {
+	float, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", fmt.Errorf("the value (%v) can't be converted to a float", value)
+	}
+
+	switch {
+	case math.IsNaN(float):
+		return "NaN", nil
+	case math.IsInf(float, 1):
+		return "Inf", nil
+	case math.IsInf(float, -1):
+		return "-Inf", nil
+	case float == 0 || (math.Abs(float) >= 1e-4 && math.Abs(float) < 1e15):
+		return strconv.FormatFloat(float, 'f', -1, 64), nil
+	}
+	return strconv.FormatFloat(float, 'e', -1, 64), nil
+}
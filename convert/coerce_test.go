@@ -0,0 +1,70 @@
+package bedgovcf
+
+import (
+	"testing"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		valueType string
+		rounding  string
+		expected  string
+	}{
+		{"12.7", "Integer", "round", "13"},
+		{"12.7", "Integer", "truncate", "12"},
+		{"-0.4", "Integer", "round", "0"},
+		{"12.0", "Integer", "error", "12"},
+		{"+007", "integer", "round", "7"},
+		{"1.5,.,2.5", "Integer", "truncate", "1,.,2"},
+		{"1.50000", "Float", "round", "1.5"},
+		{"1e3", "Float", "round", "1000"},
+		{"0.00001", "Float", "round", "1e-05"},
+		{"inf", "Float", "round", "Inf"},
+		{"A", "Character", "round", "A"},
+		{"abc", "String", "round", "abc"},
+		{".", "Integer", "round", "."},
+	}
+	for _, test := range tests {
+		value, err := coerceValue(test.value, test.valueType, test.rounding)
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got %v", test.value, err)
+		}
+		if value != test.expected {
+			t.Fatalf("Expected %v to be coerced to %v (%v), got %v", test.value, test.expected, test.valueType, value)
+		}
+	}
+
+	errorTests := []struct {
+		value     string
+		valueType string
+		rounding  string
+	}{
+		{"abc", "Integer", "round"},
+		{"12.7", "Integer", "error"},
+		{"3000000000", "Integer", "round"},
+		{"abc", "Float", "round"},
+		{"AB", "Character", "round"},
+	}
+	for _, test := range errorTests {
+		if _, err := coerceValue(test.value, test.valueType, test.rounding); err == nil {
+			t.Fatalf("Expected an error for %v (%v)", test.value, test.valueType)
+		}
+	}
+}
+
+func TestRowErrorHandler(t *testing.T) {
+	if _, err := newRowErrorHandler("ignore"); err == nil {
+		t.Fatalf("Expected an error for an unsupported policy")
+	}
+
+	handler, _ := newRowErrorHandler("")
+	if handler.handle(&ConversionError{Line: 1}) == nil {
+		t.Fatalf("Expected the error to be returned with the default policy")
+	}
+
+	handler, _ = newRowErrorHandler("drop")
+	if handler.handle(&ConversionError{Line: 1}) != nil || handler.Dropped != 1 {
+		t.Fatalf("Expected the row to be dropped")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -22,12 +23,14 @@ func ReadConfig(configString string) (Config, error) {
 		return Config{}, fmt.Errorf("failed to open the config file: %v", err)
 	}
 
-	config.validate()
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
 	return config, nil
 }
 
-// Validate the config
-func (c *Config) validate() {
+// Validate the config, missing values are replaced by their defaults
+func (c *Config) validate() error {
 	logger := log.New(os.Stderr, "", 0)
 	if c.Chrom.Value == "" {
 		logger.Printf("No value defined for CHROM, defaulting to the column 0")
@@ -39,8 +42,8 @@ func (c *Config) validate() {
 		c.Pos.Value = "$1"
 	}
 
-	if c.Id.Value == "" && c.Id.Prefix == "" {
-		logger.Printf("No value or prefix specified for the ID, defaulting to prefix 'id_")
+	if c.Id.Value == "" && c.Id.Prefix == "" && c.Id.Template == "" {
+		logger.Printf("No value, prefix or template specified for the ID, defaulting to prefix 'id_")
 		c.Id.Prefix = "id_"
 	}
 
@@ -54,19 +57,37 @@ func (c *Config) validate() {
 		c.Alt.Value = "<CNV>"
 	}
 
+	if c.Rounding == "" {
+		c.Rounding = "round"
+	} else if !slices.Contains([]string{"round", "truncate", "error"}, c.Rounding) {
+		return fmt.Errorf("the rounding '%v' is not supported, use 'round', 'truncate' or 'error'", c.Rounding)
+	}
+
 	if c.Qual.Value == "" {
 		logger.Printf("No value specified for the QUAL, defaulting to value '.'")
 		c.Qual.Value = "."
 	}
 
-	if c.Filter.Value == "" {
+	if len(c.Filter.Rules) != 0 {
+		if c.Filter.Value != "" {
+			logger.Printf("Both a value and rules are specified for the FILTER, the value will be ignored")
+		}
+		for i, v := range c.Filter.Rules {
+			if v.Name == "" {
+				return fmt.Errorf("the FILTER rule at position %v has no name", i+1)
+			}
+			if v.Condition == "" {
+				return fmt.Errorf("the FILTER rule '%v' has no condition", v.Name)
+			}
+		}
+	} else if c.Filter.Value == "" {
 		logger.Printf("No value specified for the FILTER, defaulting to value 'PASS'")
 		c.Filter.Value = "PASS"
 	}
 
 	if len(c.Info) != 0 {
 		for _, v := range c.Info {
-			if v.Value == "" {
+			if v.Value == "" && strings.ToLower(v.Type) != "flag" {
 				logger.Printf("No value specified for the INFO/%v", strings.ToUpper(v.Name))
 			}
 		}
@@ -80,4 +101,5 @@ func (c *Config) validate() {
 		}
 	}
 
+	return nil
 }
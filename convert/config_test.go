@@ -1,3 +1,51 @@
 package bedgovcf
 
-// TODO write config tests
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadConfigFilterRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		config string
+		valid  bool
+	}{
+		{"filter:\n  rules:\n    - name: LowQual\n      condition: $4 < 10\n", true},
+		{"filter:\n  rules:\n    - condition: $4 < 10\n", false},
+		{"filter:\n  rules:\n    - name: LowQual\n", false},
+	} {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(test.config), 0644)
+		_, err := ReadConfig(path)
+		if test.valid && err != nil {
+			t.Fatalf("Expected no error for %q, got %v", test.config, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("Expected an error for %q, got none", test.config)
+		}
+	}
+}
+
+func TestReadConfigRounding(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		config string
+		valid  bool
+	}{
+		{"rounding: truncate\n", true},
+		{"rounding: error\n", true},
+		{"rounding: trunc\n", false},
+	} {
+		path := filepath.Join(dir, "config.yaml")
+		os.WriteFile(path, []byte(test.config), 0644)
+		_, err := ReadConfig(path)
+		if test.valid && err != nil {
+			t.Fatalf("Expected no error for %q, got %v", test.config, err)
+		}
+		if !test.valid && err == nil {
+			t.Fatalf("Expected an error for %q, got none", test.config)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package bedgovcf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+//go:embed assemblies/*.tsv
+var assemblyTables embed.FS
+
+// The assemblies that are embedded in bedgovcf and their aliases
+var assemblyAliases = map[string][]string{
+	"GRCh37":    {"grch37", "hg19", "b37", "hs37d5"},
+	"GRCh38":    {"grch38", "hg38"},
+	"T2T-CHM13": {"t2t-chm13", "chm13", "t2t", "hs1"},
+	"GRCm39":    {"grcm39", "mm39"},
+}
+
+// The aliases that differ from their embedded assembly: the naming convention of their contigs
+// and the contig lengths that differ (by UCSC name, hg19 has the 16571 bp Yoruba chrM instead of the rCRS)
+var assemblyVariants = map[string]struct {
+	Convention string
+	Lengths    map[string]int64
+}{
+	"hg19":   {"ucsc", map[string]int64{"chrM": 16571}},
+	"b37":    {"ensembl", nil},
+	"hs37d5": {"ensembl", nil},
+}
+
+// The struct for one contig of the reference
+type Contig struct {
+	Name     string // The name of the contig
+	Length   int64  // The length of the contig
+	Md5      string // The MD5 checksum of the contig sequence
+	Assembly string // The assembly the contig belongs to
+	Url      string // The URL of the reference the contig was read from
+	Species  string // The species the contig belongs to
+}
+
+// Read the contigs from the source given on the command line and add them to the VCF header
+func (h *Header) setContigsFromContext(cCtx *cli.Context, config Config) error {
+	var contigs []Contig
+	var err error
+	switch {
+	case cCtx.String("fai") != "":
+		contigs, err = readFai(cCtx.String("fai"))
+	case cCtx.String("dict") != "":
+		contigs, err = readDict(cCtx.String("dict"))
+	case cCtx.String("fasta") != "":
+		contigs, err = readFastaContigs(cCtx.String("fasta"))
+	case cCtx.String("assembly") != "":
+		contigs, err = readAssembly(cCtx.String("assembly"))
+	default:
+		err = errors.New("no contigs were given, use one of --fai, --dict, --fasta or --assembly")
+	}
+	if err != nil {
+		return err
+	}
+
+	if cCtx.Bool("md5") {
+		if cCtx.String("fasta") == "" {
+			return errors.New("the MD5 checksums of the contigs can only be calculated when --fasta is given")
+		}
+		digests, err := readFastaDigests(cCtx.String("fasta"))
+		if err != nil {
+			return err
+		}
+		for i, v := range contigs {
+			if digest, ok := digests[v.Name]; ok {
+				contigs[i].Md5 = digest
+			}
+		}
+	}
+
+	for i := range contigs {
+		if config.Assembly != "" {
+			contigs[i].Assembly = config.Assembly
+		}
+		contigs[i].Species = config.Species
+	}
+
+	reference := getReference(cCtx, contigs)
+	if reference != "" && !cCtx.Bool("no-reference") {
+		h.addLine(HeaderLine{Category: "reference", Content: reference})
+	}
+
+	h.addContigs(contigs)
+	return nil
+}
+
+// Get the location of the reference used for the contigs
+func getReference(cCtx *cli.Context, contigs []Contig) string {
+	if cCtx.String("fasta") != "" {
+		path, err := filepath.Abs(cCtx.String("fasta"))
+		if err != nil {
+			path = cCtx.String("fasta")
+		}
+		return "file://" + path
+	}
+	// The FASTA file is expected next to its index
+	if strings.HasSuffix(cCtx.String("fai"), ".fai") {
+		path, err := filepath.Abs(strings.TrimSuffix(cCtx.String("fai"), ".fai"))
+		if err != nil {
+			path = strings.TrimSuffix(cCtx.String("fai"), ".fai")
+		}
+		return "file://" + path
+	}
+	if cCtx.String("fai") == "" {
+		for _, v := range contigs {
+			if v.Url != "" {
+				return v.Url
+			}
+		}
+	}
+	if cCtx.String("fai") == "" && cCtx.String("dict") == "" && cCtx.String("assembly") != "" {
+		name, err := assemblyName(cCtx.String("assembly"))
+		if err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// Add the contigs to the VCF header
+func (h *Header) addContigs(contigs []Contig) {
+	for _, v := range contigs {
+		line := newHeaderLine("contig", "ID", v.Name, "length", strconv.FormatInt(v.Length, 10))
+		// The optional attributes are only added when they are known
+		for _, attribute := range []HeaderAttribute{{"assembly", v.Assembly}, {"md5", v.Md5}, {"species", v.Species}, {"URL", v.Url}} {
+			if attribute.Value != "" {
+				line.set(attribute.Key, attribute.Value)
+			}
+		}
+		h.addLine(line)
+	}
+}
+
+// Read the contigs from a fasta index file
+func readFai(faidx string) ([]Contig, error) {
+	file, err := os.Open(faidx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the fasta index file: %v", err)
+	}
+	defer file.Close()
+
+	contigs := []Contig{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if scanner.Text() == "" {
+			continue
+		}
+		line := strings.Split(scanner.Text(), "\t")
+		if len(line) < 2 {
+			return nil, &ConversionError{File: faidx, Line: lineNumber, Err: errors.New("expected at least 2 columns in the fasta index file")}
+		}
+		length, err := strconv.ParseInt(line[1], 10, 64)
+		if err != nil {
+			return nil, &ConversionError{File: faidx, Line: lineNumber, Err: fmt.Errorf("failed to parse the contig length (%v) to an integer", line[1])}
+		}
+		contigs = append(contigs, Contig{Name: line[0], Length: length})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the fasta index file: %v", err)
+	}
+	return contigs, nil
+}
+
+// Read the contigs from a sequence dictionary (@SQ lines with SN, LN, M5, AS and UR)
+func readDict(dict string) ([]Contig, error) {
+	file, err := os.Open(dict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the sequence dictionary: %v", err)
+	}
+	defer file.Close()
+
+	contigs := []Contig{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.Split(scanner.Text(), "\t")
+		if line[0] != "@SQ" {
+			continue
+		}
+
+		contig := Contig{}
+		for _, field := range line[1:] {
+			key, value, found := strings.Cut(field, ":")
+			if !found {
+				continue
+			}
+			switch key {
+			case "SN":
+				contig.Name = value
+			case "LN":
+				contig.Length, err = strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, &ConversionError{File: dict, Line: lineNumber, Err: fmt.Errorf("failed to parse the contig length (%v) to an integer", value)}
+				}
+			case "M5":
+				contig.Md5 = value
+			case "AS":
+				contig.Assembly = value
+			case "UR":
+				contig.Url = value
+			}
+		}
+		if contig.Name == "" || contig.Length == 0 {
+			return nil, &ConversionError{File: dict, Line: lineNumber, Err: errors.New("the @SQ line should contain a SN and LN field")}
+		}
+		contigs = append(contigs, contig)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the sequence dictionary: %v", err)
+	}
+	return contigs, nil
+}
+
+// Read the contigs from a fasta file, the index is used when it's present
+func readFastaContigs(fasta string) ([]Contig, error) {
+	if _, err := os.Stat(fasta + ".fai"); err == nil {
+		return readFai(fasta + ".fai")
+	}
+
+	contigs := []Contig{}
+	err := scanFasta(fasta, func(name string, length int64, md5 string) {
+		contigs = append(contigs, Contig{Name: name, Length: length})
+	}, false)
+	return contigs, err
+}
+
+// Calculate the MD5 checksums of all sequences in a fasta file
+func readFastaDigests(fasta string) (map[string]string, error) {
+	digests := map[string]string{}
+	err := scanFasta(fasta, func(name string, length int64, md5 string) {
+		digests[name] = md5
+	}, true)
+	return digests, err
+}
+
+// Scan a (gzipped) fasta file and call the callback for every sequence
+// The MD5 checksum of the upper case sequence is only calculated when digest is true
+func scanFasta(fasta string, callback func(name string, length int64, md5 string), digest bool) error {
+	file, err := os.Open(fasta)
+	if err != nil {
+		return fmt.Errorf("failed to open the fasta file: %v", err)
+	}
+	defer file.Close()
+
+	var input io.Reader = file
+	if strings.HasSuffix(fasta, ".gz") {
+		gzipReader, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open the gzipped fasta file: %v", err)
+		}
+		defer gzipReader.Close()
+		input = gzipReader
+	}
+
+	reader := bufio.NewReaderSize(input, 1<<20)
+	name := ""
+	sequenceHash := md5.New()
+	var length int64
+	newLine := true
+	header := false
+	headerLine := []byte{}
+
+	emit := func() {
+		if name != "" {
+			checksum := ""
+			if digest {
+				checksum = hex.EncodeToString(sequenceHash.Sum(nil))
+			}
+			callback(name, length, checksum)
+		}
+		sequenceHash.Reset()
+		length = 0
+	}
+
+	for {
+		line, isPrefix, err := reader.ReadLine()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("failed to read the fasta file: %v", err)
+		}
+
+		if newLine && len(line) > 0 && line[0] == '>' {
+			emit()
+			header = true
+			headerLine = headerLine[:0]
+		}
+		if header {
+			headerLine = append(headerLine, line...)
+			if !isPrefix {
+				fields := strings.Fields(string(headerLine[1:]))
+				if len(fields) == 0 {
+					return fmt.Errorf("the fasta file (%v) contains a sequence without a name", fasta)
+				}
+				name = fields[0]
+				header = false
+			}
+		} else {
+			line = bytes.TrimSpace(line)
+			length += int64(len(line))
+			if digest {
+				sequenceHash.Write(bytes.ToUpper(line))
+			}
+		}
+		newLine = !isPrefix
+	}
+	emit()
+
+	if name == "" {
+		return fmt.Errorf("the fasta file (%v) doesn't contain any sequences", fasta)
+	}
+	return nil
+}
+
+// Get the name of an embedded assembly from its name or one of its aliases
+func assemblyName(assembly string) (string, error) {
+	for name, aliases := range assemblyAliases {
+		if slices.Contains(aliases, strings.ToLower(assembly)) {
+			return name, nil
+		}
+	}
+
+	names := []string{}
+	for name := range assemblyAliases {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return "", fmt.Errorf("the assembly (%v) is not supported, use one of %v", assembly, strings.Join(names, ", "))
+}
+
+// Read the contigs of an embedded assembly
+func readAssembly(assembly string) ([]Contig, error) {
+	name, err := assemblyName(assembly)
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := assemblyTables.ReadFile(fmt.Sprintf("assemblies/%v.tsv", name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the embedded assembly %v: %v", name, err)
+	}
+
+	contigs := []Contig{}
+	for _, v := range strings.Split(string(table), "\n") {
+		if v == "" || strings.HasPrefix(v, "#") {
+			continue
+		}
+		line := strings.Split(v, "\t")
+		length, err := strconv.ParseInt(line[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the contig length (%v) of the embedded assembly %v", line[1], name)
+		}
+		contig := Contig{Name: line[0], Length: length, Assembly: name}
+		if variant, ok := assemblyVariants[strings.ToLower(assembly)]; ok {
+			if override, ok := variant.Lengths[line[0]]; ok {
+				contig.Length = override
+			}
+			if variant.Convention == "ensembl" {
+				contig.Name = line[2]
+			}
+		}
+		contigs = append(contigs, contig)
+	}
+	return contigs, nil
+}
+
+// The struct that checks variants against the contigs of the header
+type ContigValidator struct {
+	Policy     string           // What to do with invalid records (error, warn or drop)
+	Lengths    map[string]int64 // The lengths of the contigs in the header
+	Violations map[string]int   // The amount of violations found per type
+	Warnings   int              // The amount of violations written as a warning
+}
+
+// The maximum amount of violations written as a warning, the others are only counted in the summary
+const maxContigWarnings = 10
+
+// The types of violations found by the contig validator
+const (
+	unknownContig = "record(s) on a contig that is not in the header"
+	pastContigEnd = "record(s) with a position past the end of the contig"
+	endBeforePos  = "record(s) with an END before the POS"
+	invalidPos    = "record(s) with a POS or END that is not an integer"
+)
+
+// Create a contig validator for the contigs in the header
+func newContigValidator(header Header, policy string) (*ContigValidator, error) {
+	if policy == "" {
+		policy = "warn"
+	}
+	if !slices.Contains([]string{"error", "warn", "drop"}, policy) {
+		return nil, fmt.Errorf("the contig policy (%v) is not supported, use 'error', 'warn' or 'drop'", policy)
+	}
+
+	return &ContigValidator{
+		Policy:     policy,
+		Lengths:    header.contigLengths(),
+		Violations: map[string]int{},
+	}, nil
+}
+
+// Get the lengths of all contigs in the header
+func (h *Header) contigLengths() map[string]int64 {
+	lengths := map[string]int64{}
+	for _, v := range h.HeaderLines {
+		if strings.ToLower(v.Category) != "contig" {
+			continue
+		}
+		length, err := strconv.ParseInt(v.get("length"), 10, 64)
+		if err != nil {
+			length = -1
+		}
+		lengths[v.id()] = length
+	}
+	return lengths
+}
+
+// Check a variant against the contigs, returns the first violation found
+func (cv *ContigValidator) check(variant Variant) error {
+	if len(cv.Lengths) == 0 {
+		return nil
+	}
+
+	length, ok := cv.Lengths[variant.Chrom]
+	if !ok {
+		cv.Violations[unknownContig]++
+		return &ConversionError{Field: "CHROM", Err: fmt.Errorf("the contig %v is not present in the header", variant.Chrom)}
+	}
+
+	pos, err := strconv.ParseInt(variant.Pos, 10, 64)
+	if err != nil {
+		cv.Violations[invalidPos]++
+		return &ConversionError{Field: "POS", Err: fmt.Errorf("failed to parse the position (%v) to an integer", variant.Pos)}
+	}
+	if length >= 0 && pos > length {
+		cv.Violations[pastContigEnd]++
+		return &ConversionError{Field: "POS", Err: fmt.Errorf("the position %v is past the end of %v (%v)", pos, variant.Chrom, length)}
+	}
+
+	for _, v := range variant.Info {
+		if strings.ToUpper(v.Name) != "END" || isMissing(v.Value) {
+			continue
+		}
+		end, err := strconv.ParseInt(v.Value, 10, 64)
+		if err != nil {
+			cv.Violations[invalidPos]++
+			return &ConversionError{Field: "INFO/END", Err: fmt.Errorf("failed to parse the end (%v) to an integer", v.Value)}
+		}
+		if length >= 0 && end > length {
+			cv.Violations[pastContigEnd]++
+			return &ConversionError{Field: "INFO/END", Err: fmt.Errorf("the end %v is past the end of %v (%v)", end, variant.Chrom, length)}
+		}
+		if end < pos {
+			cv.Violations[endBeforePos]++
+			return &ConversionError{Field: "INFO/END", Err: fmt.Errorf("the end %v is before the position %v", end, pos)}
+		}
+	}
+
+	return nil
+}
+
+// Write a violation as a warning, only the first violations are written to keep the log readable
+func (cv *ContigValidator) warn(violation error) {
+	logger := log.New(os.Stderr, "", 0)
+	cv.Warnings++
+	if cv.Warnings <= maxContigWarnings {
+		logger.Printf("WARNING: %v", violation)
+	}
+	if cv.Warnings == maxContigWarnings {
+		logger.Printf("WARNING: only the first %v contig violations are shown, the others are counted in the summary", maxContigWarnings)
+	}
+}
+
+// Summarize the violations found by the contig validator
+func (cv *ContigValidator) summary() []string {
+	summary := []string{}
+	for _, violation := range []string{unknownContig, pastContigEnd, endBeforePos, invalidPos} {
+		if cv.Violations[violation] != 0 {
+			summary = append(summary, fmt.Sprintf("Found %v %v (policy: %v)", cv.Violations[violation], violation, cv.Policy))
+		}
+	}
+	return summary
+}
@@ -0,0 +1,140 @@
+package bedgovcf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadDict(t *testing.T) {
+	contigs, err := readDict("../test_data/test.dict")
+	if err != nil {
+		t.Fatalf("Failed to read the sequence dictionary: %v", err)
+	}
+	if len(contigs) != 2 {
+		t.Fatalf("Expected 2 contigs, got %d", len(contigs))
+	}
+	expected := Contig{
+		Name:     "chr1",
+		Length:   248956422,
+		Md5:      "6aef897c3d6ff0c78aff06ac189178dd",
+		Assembly: "GRCh38",
+		Url:      "file:///references/GRCh38.fa",
+	}
+	if contigs[0] != expected {
+		t.Fatalf("Expected contig 0 to be %v, got %v", expected, contigs[0])
+	}
+}
+
+func TestReadFastaContigs(t *testing.T) {
+	contigs, err := readFastaContigs("../test_data/test.fa")
+	if err != nil {
+		t.Fatalf("Failed to scan the fasta file: %v", err)
+	}
+	expected := []Contig{
+		{Name: "chr1", Length: 15},
+		{Name: "chr2", Length: 5},
+	}
+	if len(contigs) != 2 || contigs[0] != expected[0] || contigs[1] != expected[1] {
+		t.Fatalf("Expected contigs to be %v, got %v", expected, contigs)
+	}
+}
+
+func TestReadAssembly(t *testing.T) {
+	contigs, err := readAssembly("hg38")
+	if err != nil {
+		t.Fatalf("Failed to read the embedded assembly: %v", err)
+	}
+	if len(contigs) != 25 {
+		t.Fatalf("Expected 25 contigs, got %d", len(contigs))
+	}
+	expected := Contig{Name: "chr1", Length: 248956422, Assembly: "GRCh38"}
+	if contigs[0] != expected {
+		t.Fatalf("Expected contig 0 to be %v, got %v", expected, contigs[0])
+	}
+
+	for _, test := range []struct {
+		assembly string
+		first    Contig
+		last     Contig
+	}{
+		{"b37", Contig{Name: "1", Length: 249250621, Assembly: "GRCh37"}, Contig{Name: "MT", Length: 16569, Assembly: "GRCh37"}},
+		{"hs37d5", Contig{Name: "1", Length: 249250621, Assembly: "GRCh37"}, Contig{Name: "MT", Length: 16569, Assembly: "GRCh37"}},
+		{"hg19", Contig{Name: "chr1", Length: 249250621, Assembly: "GRCh37"}, Contig{Name: "chrM", Length: 16571, Assembly: "GRCh37"}},
+		{"GRCh37", Contig{Name: "chr1", Length: 249250621, Assembly: "GRCh37"}, Contig{Name: "chrM", Length: 16569, Assembly: "GRCh37"}},
+	} {
+		contigs, err := readAssembly(test.assembly)
+		if err != nil {
+			t.Fatalf("Failed to read the embedded assembly %v: %v", test.assembly, err)
+		}
+		if contigs[0] != test.first || contigs[len(contigs)-1] != test.last {
+			t.Fatalf("Expected %v to start with %v and end with %v, got %v and %v", test.assembly, test.first, test.last, contigs[0], contigs[len(contigs)-1])
+		}
+	}
+
+	_, err = readAssembly("hg17")
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported assembly")
+	}
+}
+
+func TestContigValidator(t *testing.T) {
+	header := Header{}
+	addTestContigs(t, &header)
+	validator, _ := newContigValidator(header, "drop")
+
+	variants := []Variant{
+		{Chrom: "chr1", Pos: "100", Info: SliceVariantInfoFormat{{Name: "end", Value: "200"}}},
+		{Chrom: "chr3", Pos: "100"},
+		{Chrom: "chr2", Pos: "242193530"},
+		{Chrom: "chr1", Pos: "100", Info: SliceVariantInfoFormat{{Name: "end", Value: "248956423"}}},
+		{Chrom: "chr1", Pos: "100", Info: SliceVariantInfoFormat{{Name: "end", Value: "50"}}},
+		{Chrom: "chr1", Pos: "abc"},
+	}
+	errorCount := 0
+	for _, v := range variants {
+		if validator.check(v) != nil {
+			errorCount++
+		}
+	}
+	if errorCount != 5 {
+		t.Fatalf("Expected 5 violations, got %d", errorCount)
+	}
+
+	summary := validator.summary()
+	expected := []string{
+		"Found 1 record(s) on a contig that is not in the header (policy: drop)",
+		"Found 2 record(s) with a position past the end of the contig (policy: drop)",
+		"Found 1 record(s) with an END before the POS (policy: drop)",
+		"Found 1 record(s) with a POS or END that is not an integer (policy: drop)",
+	}
+	if !reflect.DeepEqual(summary, expected) {
+		t.Fatalf("Expected summary to be %v, got %v", expected, summary)
+	}
+
+	_, err := newContigValidator(header, "ignore")
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported policy")
+	}
+}
+
+func TestReadFastaDigests(t *testing.T) {
+	digests, err := readFastaDigests("../test_data/test.fa")
+	if err != nil {
+		t.Fatalf("Failed to calculate the checksums: %v", err)
+	}
+	if digests["chr1"] != "55e136f3b2fdc89a7ce5aafeed0e053c" {
+		t.Fatalf("Expected the checksum of chr1 to be 55e136f3b2fdc89a7ce5aafeed0e053c, got %s", digests["chr1"])
+	}
+	// The checksum is calculated on the upper case sequence
+	if digests["chr2"] != "252fe4e1c9aa67ce660443056dfa3799" {
+		t.Fatalf("Expected the checksum of chr2 to be 252fe4e1c9aa67ce660443056dfa3799, got %s", digests["chr2"])
+	}
+}
+
+func TestContigHeaderLine(t *testing.T) {
+	line := newHeaderLine("contig", "ID", "chr1", "length", "248956422", "assembly", "GRCh38", "md5", "6aef897c3d6ff0c78aff06ac189178dd", "species", "Homo sapiens", "URL", "file:///references/GRCh38.fa")
+	expected := "##contig=<ID=chr1,length=248956422,assembly=GRCh38,md5=6aef897c3d6ff0c78aff06ac189178dd,species=\"Homo sapiens\",URL=file:///references/GRCh38.fa>"
+	if line.String() != expected {
+		t.Fatalf("Expected the header line to be '%s', got '%s'", expected, line.String())
+	}
+}
@@ -0,0 +1,78 @@
+package bedgovcf
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The error returned when a row of the input file could not be converted
+type ConversionError struct {
+	File       string // The input file the row was read from
+	Line       int    // The line number of the row in the input file (1-based)
+	Field      string // The VCF field that was being resolved (e.g. INFO/SVLEN)
+	Expression string // The config expression that was being resolved
+	Err        error  // The underlying cause of the error
+}
+
+// Convert the conversion error to a string
+func (e *ConversionError) Error() string {
+	location := []string{}
+	if e.File != "" {
+		location = append(location, e.File)
+	}
+	if e.Line != 0 {
+		location = append(location, fmt.Sprintf("%v", e.Line))
+	}
+
+	message := strings.Join(location, ":")
+	if e.Field != "" {
+		message = strings.TrimSpace(fmt.Sprintf("%v %v", message, e.Field))
+	}
+	if e.Expression != "" {
+		message = strings.TrimSpace(fmt.Sprintf("%v (%v)", message, e.Expression))
+	}
+
+	if message == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %v", message, e.Err)
+}
+
+// Return the underlying cause of the conversion error
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// The struct that handles the rows that could not be converted according to the row error policy
+type RowErrorHandler struct {
+	Policy  string // What to do with rows that can't be converted (error, warn or drop)
+	Dropped int    // The amount of rows that were dropped
+}
+
+// Create a handler for the rows that could not be converted
+func newRowErrorHandler(policy string) (*RowErrorHandler, error) {
+	if policy == "" {
+		policy = "error"
+	}
+	if !slices.Contains([]string{"error", "warn", "drop"}, policy) {
+		return nil, fmt.Errorf("the error policy (%v) is not supported, use 'error', 'warn' or 'drop'", policy)
+	}
+	return &RowErrorHandler{Policy: policy}, nil
+}
+
+// Handle the error of a row, the error is returned when the conversion should stop
+func (reh *RowErrorHandler) handle(err error) error {
+	switch reh.Policy {
+	case "warn":
+		logger := log.New(os.Stderr, "", 0)
+		logger.Printf("WARNING: %v", err)
+	case "drop":
+	default:
+		return err
+	}
+	reh.Dropped++
+	return nil
+}
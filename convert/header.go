@@ -0,0 +1,98 @@
+package bedgovcf
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The attributes that are always quoted in the header
+var quotedAttributes = []string{"Description", "Source", "Version", "species"}
+
+// Create a structured header line from key value pairs (e.g. "ID", "END", "Number", "1")
+func newHeaderLine(category string, attributes ...string) HeaderLine {
+	line := HeaderLine{Category: category}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		line.Attributes = append(line.Attributes, HeaderAttribute{Key: attributes[i], Value: attributes[i+1]})
+	}
+	return line
+}
+
+// Get the value of an attribute, returns an empty string when the attribute isn't present
+func (hl HeaderLine) get(key string) string {
+	for _, v := range hl.Attributes {
+		if strings.EqualFold(v.Key, key) {
+			return v.Value
+		}
+	}
+	return ""
+}
+
+// Set the value of an attribute, new attributes are added at the end
+func (hl *HeaderLine) set(key string, value string) {
+	for i, v := range hl.Attributes {
+		if strings.EqualFold(v.Key, key) {
+			hl.Attributes[i].Value = value
+			return
+		}
+	}
+	hl.Attributes = append(hl.Attributes, HeaderAttribute{Key: key, Value: value})
+}
+
+// Remove an attribute
+func (hl *HeaderLine) remove(key string) {
+	hl.Attributes = slices.DeleteFunc(hl.Attributes, func(v HeaderAttribute) bool {
+		return strings.EqualFold(v.Key, key)
+	})
+}
+
+// Get the ID of a structured header line
+func (hl HeaderLine) id() string {
+	return hl.get("ID")
+}
+
+// Add a header line at the end of the header lines
+func (h *Header) addLine(line HeaderLine) {
+	h.HeaderLines = append(h.HeaderLines, line)
+}
+
+// Check if an attribute value has to be quoted, lists between square brackets are written as they are
+func needsQuotes(key string, value string) bool {
+	if slices.ContainsFunc(quotedAttributes, func(v string) bool { return strings.EqualFold(v, key) }) {
+		return true
+	}
+	if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+		return false
+	}
+	return value == "" || strings.ContainsAny(value, ",\"\\<>= \t")
+}
+
+// Read the attributes from a YAML mapping, the order of the mapping is kept
+func (ca *ConfigAttributes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return errors.New("the attributes of a header line should be a mapping (e.g. ID: value)")
+	}
+	*ca = ConfigAttributes{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i+1].Kind != yaml.ScalarNode {
+			return fmt.Errorf("the value of attribute %v should be a single value", node.Content[i].Value)
+		}
+		*ca = append(*ca, HeaderAttribute{Key: node.Content[i].Value, Value: node.Content[i+1].Value})
+	}
+	return nil
+}
+
+// Write the attributes as a YAML mapping in their order
+func (ca ConfigAttributes) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range ca {
+		node.Content = append(node.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: v.Key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: v.Value},
+		)
+	}
+	return node, nil
+}
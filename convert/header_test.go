@@ -0,0 +1,93 @@
+package bedgovcf
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestHeaderLineAttributes(t *testing.T) {
+	line := newHeaderLine("INFO", "ID", "svlen", "Number", "1", "Type", "integer", "Description", "Length")
+	line.set("Source", "bedgovcf")
+	line.set("Version", "1.0")
+	line.set("number", ".")
+	line.remove("Version")
+
+	expected := `##INFO=<ID=SVLEN,Number=.,Type=Integer,Description="Length",Source="bedgovcf">`
+	if line.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, line.String())
+	}
+	if line.get("source") != "bedgovcf" || line.get("Version") != "" {
+		t.Fatalf("Expected the attributes to be found case insensitive, got %v", line.Attributes)
+	}
+
+	sample := newHeaderLine("SAMPLE", "ID", "tumor", "Assay", "WholeGenome", "Ethnicity", "AFR", "Disease", "None", "Description", "Patient germline genome")
+	expected = `##SAMPLE=<ID=tumor,Assay=WholeGenome,Ethnicity=AFR,Disease=None,Description="Patient germline genome">`
+	if sample.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, sample.String())
+	}
+
+	meta := `##META=<ID=Assay,Type=String,Number=.,Values=[WholeGenome, Exome]>`
+	parsed, err := parseHeaderLine(meta)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if parsed.get("Values") != "[WholeGenome, Exome]" || parsed.String() != meta {
+		t.Fatalf("Expected the list to be kept, got %v", parsed.String())
+	}
+}
+
+func TestConfigAttributes(t *testing.T) {
+	input := `
+header:
+  - name: SAMPLE
+    attributes:
+      ID: tumor
+      Assay: WholeGenome
+      Description: Tumor sample
+  - name: source
+    content: test
+info:
+  - name: svlen
+    value: $2
+    attributes:
+      Source: caller
+      Version: "2.1"
+`
+	config := Config{}
+	if err := yaml.Unmarshal([]byte(input), &config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	header := Header{}
+	if err := header.setHeaderLines(config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []string{
+		`##SAMPLE=<ID=tumor,Assay=WholeGenome,Description="Tumor sample">`,
+		`##source=test`,
+		`##INFO=<ID=SVLEN,Number=.,Type=String,Description="",Source="caller",Version="2.1">`,
+	}
+	for i, v := range expected {
+		if header.HeaderLines[i].String() != v {
+			t.Fatalf("Expected %v, got %v", v, header.HeaderLines[i].String())
+		}
+	}
+
+	// The order of the attributes is kept when the config is written again
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	roundTrip := Config{}
+	if err := yaml.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(roundTrip.Header[0].Attributes) != 3 || roundTrip.Header[0].Attributes[1].Key != "Assay" {
+		t.Fatalf("Expected the attributes to round-trip, got %v", roundTrip.Header[0].Attributes)
+	}
+
+	if err := yaml.Unmarshal([]byte("header:\n  - name: X\n    attributes: [a, b]\n"), &Config{}); err == nil {
+		t.Fatalf("Expected an error for attributes that aren't a mapping, got none")
+	}
+}
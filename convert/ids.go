@@ -0,0 +1,126 @@
+package bedgovcf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The placeholders of an ID template (e.g. {chrom} or {svtype})
+var idPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// The struct that assigns the final IDs of the records and detects duplicates
+type IdGenerator struct {
+	Counter    bool           // Whether the record count is appended to the ID
+	Policy     string         // What to do with duplicate IDs (warn, error or rename)
+	Seen       map[string]int // The amount of times each ID was written
+	Duplicates int            // The amount of duplicate IDs
+}
+
+// Create an ID generator, the counter is used by default unless the ID is created with a template
+func newIdGenerator(config ConfigStandardFieldStruct, policy string) (*IdGenerator, error) {
+	if policy == "" {
+		policy = "warn"
+	}
+	if !slices.Contains([]string{"warn", "error", "rename"}, policy) {
+		return nil, fmt.Errorf("the duplicate ID policy (%v) is not supported, use 'warn', 'error' or 'rename'", policy)
+	}
+
+	counter := config.Template == ""
+	if config.Counter != nil {
+		counter = *config.Counter
+	}
+	return &IdGenerator{
+		Counter: counter,
+		Policy:  policy,
+		Seen:    map[string]int{},
+	}, nil
+}
+
+// Get the final ID of a record, the count is the index of the record in the output
+func (ig *IdGenerator) assign(id string, count int) (string, error) {
+	if ig.Counter {
+		id = fmt.Sprintf("%v%v", id, count)
+	}
+	if isMissing(id) {
+		return id, nil
+	}
+
+	ig.Seen[id]++
+	if ig.Seen[id] == 1 {
+		return id, nil
+	}
+
+	ig.Duplicates++
+	switch ig.Policy {
+	case "error":
+		return "", fmt.Errorf("the ID %v is used by more than one record, use a more specific ID template or --duplicate-ids rename", id)
+	case "rename":
+		// Find a suffix that isn't used yet
+		for suffix := ig.Seen[id] - 1; ; suffix++ {
+			renamed := fmt.Sprintf("%v_%v", id, suffix)
+			if ig.Seen[renamed] == 0 {
+				ig.Seen[renamed]++
+				return renamed, nil
+			}
+		}
+	}
+	logger := log.New(os.Stderr, "", 0)
+	logger.Printf("WARNING: the ID %v is used by more than one record", id)
+	return id, nil
+}
+
+// Fill in the placeholders of an ID template with the values of a variant
+// The placeholders are sample, chrom, pos, end, ref, alt, hash and the names of the INFO fields
+func (v Variant) fillTemplate(template string, sample string) (string, error) {
+	var err error
+	id := idPlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		name := strings.ToLower(match[1 : len(match)-1])
+		switch name {
+		case "sample":
+			return sample
+		case "chrom":
+			return v.Chrom
+		case "pos":
+			return v.Pos
+		case "end":
+			_, end, intervalErr := v.interval()
+			if intervalErr != nil {
+				err = intervalErr
+			}
+			return fmt.Sprintf("%v", end)
+		case "ref":
+			return v.Ref
+		case "alt":
+			return v.Alt
+		case "hash":
+			return v.hash()
+		}
+		for _, info := range v.Info {
+			if strings.ToLower(info.Name) == name {
+				return info.Value
+			}
+		}
+		err = fmt.Errorf("the placeholder %v of the ID template is not a known field or INFO field", match)
+		return match
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(id, " \t;") {
+		return "", fmt.Errorf("the ID (%v) contains whitespace or semicolons", id)
+	}
+	return id, nil
+}
+
+// Create a deterministic hash of the content of a variant (CHROM, POS, REF, ALT and INFO)
+func (v Variant) hash() string {
+	content := strings.Join([]string{v.Chrom, v.Pos, v.Ref, v.Alt, v.Info.infoString()}, "\t")
+	digest := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(digest[:8])
+}
@@ -0,0 +1,87 @@
+package bedgovcf
+
+import (
+	"testing"
+)
+
+func TestFillTemplate(t *testing.T) {
+	variant := Variant{
+		Chrom: "chr1",
+		Pos:   "100",
+		Ref:   "N",
+		Alt:   "<DEL>",
+		Info: SliceVariantInfoFormat{
+			{Name: "END", Value: "250"},
+			{Name: "SVTYPE", Value: "DEL"},
+		},
+	}
+
+	id, err := variant.fillTemplate("{sample}_{chrom}_{pos}_{end}_{svtype}", "test")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if id != "test_chr1_100_250_DEL" {
+		t.Fatalf("Expected test_chr1_100_250_DEL, got %v", id)
+	}
+
+	first, err := variant.fillTemplate("{hash}", "test")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(first) != 16 {
+		t.Fatalf("Expected a hash of 16 characters, got %v", first)
+	}
+	second, _ := variant.fillTemplate("{hash}", "other")
+	if first != second {
+		t.Fatalf("Expected the hash to be deterministic, got %v and %v", first, second)
+	}
+	variant.Pos = "101"
+	third, _ := variant.fillTemplate("{hash}", "test")
+	if first == third {
+		t.Fatalf("Expected a different hash for a different record, got %v", third)
+	}
+
+	_, err = variant.fillTemplate("{chrom}_{unknown}", "test")
+	if err == nil {
+		t.Fatalf("Expected an error for an unknown placeholder, got none")
+	}
+}
+
+func TestIdGenerator(t *testing.T) {
+	ids, err := newIdGenerator(ConfigStandardFieldStruct{Prefix: "id_"}, "warn")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	id, _ := ids.assign("id_", 3)
+	if id != "id_3" {
+		t.Fatalf("Expected the counter to be appended (id_3), got %v", id)
+	}
+
+	ids, _ = newIdGenerator(ConfigStandardFieldStruct{Template: "{chrom}"}, "rename")
+	expected := []string{"chr1", "chr1_1", "chr1_2", "chr2"}
+	for i, v := range []string{"chr1", "chr1", "chr1", "chr2"} {
+		id, err := ids.assign(v, i)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if id != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected[i], id)
+		}
+	}
+	if ids.Duplicates != 2 {
+		t.Fatalf("Expected 2 duplicates, got %v", ids.Duplicates)
+	}
+
+	counter := false
+	ids, _ = newIdGenerator(ConfigStandardFieldStruct{Value: "$3", Counter: &counter}, "error")
+	if _, err := ids.assign("a", 0); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := ids.assign("a", 1); err == nil {
+		t.Fatalf("Expected an error for a duplicate ID, got none")
+	}
+
+	if _, err := newIdGenerator(ConfigStandardFieldStruct{}, "ignore"); err == nil {
+		t.Fatalf("Expected an error for an unsupported policy, got none")
+	}
+}
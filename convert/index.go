@@ -0,0 +1,451 @@
+package bedgovcf
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"slices"
+)
+
+// The settings of the tabix and CSI indexes
+const (
+	indexMinShift    = 14         // The size of the smallest bins and the linear index windows (16kb)
+	tabixDepth       = 5          // The amount of levels in a tabix index
+	tabixCsiDepth    = 6          // The amount of levels htslib uses for CSI indexes of VCF files ((31 - 14 + 2) / 3)
+	tabixMaxEnd      = 1 << 29    // The maximum position that can be indexed with tabix
+	indexUnset32     = ^uint32(0) // The unset value of a bin
+	indexMarkerDist  = 0x10000    // Bins that span less compressed bytes than this are merged into their parent (HTS_MIN_MARKER_DIST)
+	khashUpperFactor = 0.77       // The maximum load of the hash table htslib stores the bins in
+)
+
+// One chunk of the index, between two BGZF positions
+type indexChunk struct {
+	Start bgzfPosition
+	End   bgzfPosition
+}
+
+// The index data of one reference sequence
+type indexReference struct {
+	Name    string                  // The name of the reference
+	Bins    map[uint32][]indexChunk // The chunks per bin
+	Linear  []bgzfPosition          // The first record position per 16kb window
+	Windows []bool                  // Whether the linear index window is set
+	First   bgzfPosition            // The position of the first record
+	Last    bgzfPosition            // The end position of the last record
+	Records uint64                  // The amount of records
+	Runs    []uint32                // The bin of every run of consecutive records, in the order they were written
+	lastBin uint32
+	lastBeg int64
+}
+
+// One bin of a finished index with the virtual offsets of its chunks
+type indexBin struct {
+	Bin    uint32      // The number of the bin
+	Offset uint64      // The virtual offset of the first record in the first window of the bin (only written to CSI indexes)
+	Chunks [][2]uint64 // The start and end virtual offsets of the chunks
+}
+
+// The struct that builds a tabix or CSI index while the records are written
+type Indexer struct {
+	Format     string            // The index format (tbi or csi)
+	Depth      int               // The amount of levels in the binning scheme
+	Preset     int32             // The tabix preset (2 for VCF, 0 for generic/BCF)
+	References []*indexReference // The references in the order they were found
+	Names      map[string]int    // The index of each reference
+	NoCoor     uint64            // The amount of records without coordinates
+}
+
+// Create an indexer, the depth of a CSI index is based on the length of the largest contig
+func newIndexer(format string, maxLength int64, preset int32) (*Indexer, error) {
+	indexer := &Indexer{
+		Format: format,
+		Preset: preset,
+		Names:  map[string]int{},
+	}
+	switch format {
+	case "tbi":
+		if maxLength > tabixMaxEnd {
+			return nil, fmt.Errorf("contigs longer than 2^29 bases can't be indexed with tabix, use a CSI index instead")
+		}
+		indexer.Depth = tabixDepth
+	case "csi":
+		// htslib uses a fixed depth for VCF files (tabix) and a depth based on the contig lengths for BCF files
+		if preset != 0 {
+			indexer.Depth = tabixCsiDepth
+			for maxLength > int64(1)<<(indexMinShift+3*indexer.Depth) {
+				indexer.Depth++
+			}
+			break
+		}
+		if maxLength <= 0 {
+			maxLength = (1 << 31) - 1
+		}
+		maxLength += 256
+		for size := int64(1) << indexMinShift; maxLength > size; size <<= 3 {
+			indexer.Depth++
+		}
+	default:
+		return nil, fmt.Errorf("the index format (%v) is not supported, use 'tbi' or 'csi'", format)
+	}
+	return indexer, nil
+}
+
+// Calculate the bin of a region (0-based, half-open) as described in the SAM specification
+func regionToBin(beg int64, end int64, minShift int, depth int) uint32 {
+	shift := minShift
+	offset := ((1 << (3 * depth)) - 1) / 7
+	for end, level := end-1, depth; level > 0; level-- {
+		if beg>>shift == end>>shift {
+			return uint32(int64(offset) + beg>>shift)
+		}
+		shift += 3
+		offset -= 1 << (3 * (level - 1))
+	}
+	return 0
+}
+
+// The pseudo bin of a binning scheme, which contains the offsets and the amount of records of a reference
+func pseudoBin(depth int) uint32 {
+	return uint32(((1<<(3*depth+3))-1)/7 + 1)
+}
+
+// Add a record (0-based, half-open) to the index
+func (ix *Indexer) add(chrom string, beg int64, end int64, start bgzfPosition, stop bgzfPosition) error {
+	if end <= beg {
+		end = beg + 1
+	}
+	if ix.Format == "tbi" && end > tabixMaxEnd {
+		return fmt.Errorf("the record at %v:%v ends past 2^29 and can't be indexed with tabix, use a CSI index instead", chrom, beg+1)
+	}
+
+	index, ok := ix.Names[chrom]
+	if !ok {
+		index = len(ix.References)
+		ix.Names[chrom] = index
+		ix.References = append(ix.References, &indexReference{
+			Name:    chrom,
+			Bins:    map[uint32][]indexChunk{},
+			First:   start,
+			lastBin: indexUnset32,
+		})
+	} else if index != len(ix.References)-1 {
+		return fmt.Errorf("the records must be sorted to create an index, %v was found again after other contigs (use --sort)", chrom)
+	}
+
+	reference := ix.References[index]
+	if beg < reference.lastBeg {
+		return fmt.Errorf("the records must be sorted to create an index, %v:%v comes after %v:%v (use --sort)", chrom, beg+1, chrom, reference.lastBeg+1)
+	}
+	reference.lastBeg = beg
+
+	bin := regionToBin(beg, end, indexMinShift, ix.Depth)
+	chunks := reference.Bins[bin]
+	if reference.lastBin == bin && len(chunks) != 0 && chunks[len(chunks)-1].End == start {
+		chunks[len(chunks)-1].End = stop
+	} else {
+		reference.Bins[bin] = append(chunks, indexChunk{Start: start, End: stop})
+		reference.Runs = append(reference.Runs, bin)
+	}
+	reference.lastBin = bin
+
+	for window := beg >> indexMinShift; window <= (end-1)>>indexMinShift; window++ {
+		for int64(len(reference.Linear)) <= window {
+			reference.Linear = append(reference.Linear, bgzfPosition{})
+			reference.Windows = append(reference.Windows, false)
+		}
+		if !reference.Windows[window] {
+			reference.Linear[window] = start
+			reference.Windows[window] = true
+		}
+	}
+
+	reference.Last = stop
+	reference.Records++
+	return nil
+}
+
+// Resolve the linear index to virtual offsets like htslib does: the windows before the first record
+// get the offset of the first record and the other unset windows get the offset of the previous window
+func (ir *indexReference) linearOffsets(writer *BgzfWriter) []uint64 {
+	offsets := make([]uint64, len(ir.Linear))
+	previous := writer.virtualOffset(ir.First)
+	for i, position := range ir.Linear {
+		if ir.Windows[i] {
+			previous = writer.virtualOffset(position)
+		}
+		offsets[i] = previous
+	}
+	return offsets
+}
+
+// Finish the bins of a reference the same way htslib does, so the index is identical to one made by tabix or bcftools
+// Small bins are merged into their parent, chunks that start in the same BGZF block are merged
+// and the bins are returned in the order htslib writes them
+func (ix *Indexer) finishBins(reference *indexReference, linear []uint64, writer *BgzfWriter) []indexBin {
+	bins := map[uint32]*indexBin{}
+	for bin, chunks := range reference.Bins {
+		finished := &indexBin{Bin: bin, Offset: ix.binOffset(bin, linear)}
+		for _, chunk := range chunks {
+			finished.Chunks = append(finished.Chunks, [2]uint64{writer.virtualOffset(chunk.Start), writer.virtualOffset(chunk.End)})
+		}
+		bins[bin] = finished
+	}
+
+	// Merge the bins that span less than the marker distance into their parent, starting at the deepest level
+	for level := ix.Depth; level > 0; level-- {
+		for bin, current := range bins {
+			if bin < binFirst(level) || bin >= binFirst(level+1) {
+				continue
+			}
+			if level < ix.Depth {
+				sortChunks(current.Chunks)
+			}
+			if current.Chunks[len(current.Chunks)-1][1]>>16-current.Chunks[0][0]>>16 >= indexMarkerDist {
+				continue
+			}
+			parent, ok := bins[(bin-1)>>3]
+			if !ok {
+				continue
+			}
+			parent.Chunks = append(parent.Chunks, current.Chunks...)
+			delete(bins, bin)
+		}
+	}
+	if root, ok := bins[0]; ok {
+		sortChunks(root.Chunks)
+	}
+
+	// Merge the adjacent chunks that start in the block the previous chunk ends in
+	for _, bin := range bins {
+		merged := bin.Chunks[:1]
+		for _, chunk := range bin.Chunks[1:] {
+			last := &merged[len(merged)-1]
+			if last[1]>>16 >= chunk[0]>>16 {
+				last[1] = max(last[1], chunk[1])
+			} else {
+				merged = append(merged, chunk)
+			}
+		}
+		bin.Chunks = merged
+	}
+
+	// htslib adds the pseudo bin twice after the last run of the reference
+	keys := append(slices.Clone(reference.Runs), pseudoBin(ix.Depth), pseudoBin(ix.Depth))
+	ordered := []indexBin{}
+	for _, bin := range khashOrder(keys) {
+		if finished, ok := bins[bin]; ok {
+			ordered = append(ordered, *finished)
+		} else if bin == pseudoBin(ix.Depth) {
+			ordered = append(ordered, indexBin{Bin: bin})
+		}
+	}
+	return ordered
+}
+
+// The first bin of a level of the binning scheme
+func binFirst(level int) uint32 {
+	return uint32(((1 << (3 * level)) - 1) / 7)
+}
+
+// Sort chunks by their start
+func sortChunks(chunks [][2]uint64) {
+	slices.SortFunc(chunks, func(a [2]uint64, b [2]uint64) int {
+		return cmp.Compare(a[0], b[0])
+	})
+}
+
+// Get the order in which htslib writes the bins of a reference: the iteration order of its hash table
+// (khash with the bin number as hash) after adding the keys in the given order
+func khashOrder(keys []uint32) []uint32 {
+	buckets := []uint32{}
+	occupied := []bool{}
+	size, upper := 0, 0
+	for _, key := range keys {
+		// The table grows before a key is added (also when the key is already present)
+		if size >= upper {
+			buckets, occupied = khashResize(buckets, occupied, max(4, 2*len(buckets)))
+			upper = int(float64(len(buckets))*khashUpperFactor + 0.5)
+		}
+		mask := uint32(len(buckets) - 1)
+		i := key & mask
+		for step := uint32(1); occupied[i] && buckets[i] != key; step++ {
+			i = (i + step) & mask
+		}
+		if !occupied[i] {
+			buckets[i] = key
+			occupied[i] = true
+			size++
+		}
+	}
+
+	order := []uint32{}
+	for i, key := range buckets {
+		if occupied[i] {
+			order = append(order, key)
+		}
+	}
+	return order
+}
+
+// Rehash the keys of the hash table into a larger table, keys that are in the way are moved like khash does
+func khashResize(buckets []uint32, occupied []bool, size int) ([]uint32, []bool) {
+	keys := make([]uint32, size)
+	copy(keys, buckets)
+	old := slices.Clone(occupied)
+	used := make([]bool, size)
+	mask := uint32(size - 1)
+	for j := range buckets {
+		if !old[j] {
+			continue
+		}
+		key := keys[j]
+		old[j] = false
+		for {
+			i := key & mask
+			for step := uint32(1); used[i]; step++ {
+				i = (i + step) & mask
+			}
+			used[i] = true
+			if int(i) < len(buckets) && old[i] {
+				keys[i], key = key, keys[i]
+				old[i] = false
+			} else {
+				keys[i] = key
+				break
+			}
+		}
+	}
+	return keys, used
+}
+
+// Write the index to a temporary file that still has to be committed to its path
+func (ix *Indexer) create(path string, names []string, writer *BgzfWriter) (*AtomicFile, error) {
+	// BCF indexes use the contig order of the header instead of the order of the records
+	references := ix.References
+	if names != nil {
+		references = []*indexReference{}
+		for _, name := range names {
+			if index, ok := ix.Names[name]; ok {
+				references = append(references, ix.References[index])
+			} else {
+				references = append(references, &indexReference{Name: name, Bins: map[uint32][]indexChunk{}})
+			}
+		}
+	}
+
+	data := []byte{}
+	switch ix.Format {
+	case "tbi":
+		data = append(data, 'T', 'B', 'I', 1)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(references)))
+		data = append(data, ix.tabixConfig()...)
+	case "csi":
+		data = append(data, 'C', 'S', 'I', 1)
+		data = binary.LittleEndian.AppendUint32(data, uint32(indexMinShift))
+		data = binary.LittleEndian.AppendUint32(data, uint32(ix.Depth))
+		aux := []byte{}
+		if ix.Preset != 0 {
+			aux = ix.tabixConfig()
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(aux)))
+		data = append(data, aux...)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(references)))
+	}
+
+	for _, reference := range references {
+		if reference.Records == 0 {
+			data = binary.LittleEndian.AppendUint32(data, 0)
+			if ix.Format == "tbi" {
+				data = binary.LittleEndian.AppendUint32(data, 0)
+			}
+			continue
+		}
+
+		linear := reference.linearOffsets(writer)
+		bins := ix.finishBins(reference, linear, writer)
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(bins)))
+		for _, bin := range bins {
+			data = binary.LittleEndian.AppendUint32(data, bin.Bin)
+			if ix.Format == "csi" {
+				data = binary.LittleEndian.AppendUint64(data, bin.Offset)
+			}
+
+			// The pseudo bin contains the offsets of the reference and the amount of records
+			if bin.Bin == pseudoBin(ix.Depth) {
+				data = binary.LittleEndian.AppendUint32(data, 2)
+				data = binary.LittleEndian.AppendUint64(data, writer.virtualOffset(reference.First))
+				data = binary.LittleEndian.AppendUint64(data, writer.virtualOffset(reference.Last))
+				data = binary.LittleEndian.AppendUint64(data, reference.Records)
+				data = binary.LittleEndian.AppendUint64(data, 0)
+				continue
+			}
+
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(bin.Chunks)))
+			for _, chunk := range bin.Chunks {
+				data = binary.LittleEndian.AppendUint64(data, chunk[0])
+				data = binary.LittleEndian.AppendUint64(data, chunk[1])
+			}
+		}
+
+		if ix.Format == "tbi" {
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(linear)))
+			for _, offset := range linear {
+				data = binary.LittleEndian.AppendUint64(data, offset)
+			}
+		}
+	}
+	data = binary.LittleEndian.AppendUint64(data, ix.NoCoor)
+
+	file, err := createAtomicFile(path)
+	if err != nil {
+		return nil, err
+	}
+	indexWriter := newBgzfWriter(file, 1)
+	if _, err := indexWriter.Write(data); err != nil {
+		file.Abort()
+		return nil, fmt.Errorf("failed to write the index file: %v", err)
+	}
+	if err := indexWriter.Close(); err != nil {
+		file.Abort()
+		return nil, fmt.Errorf("failed to write the index file: %v", err)
+	}
+	return file, file.Close()
+}
+
+// The tabix configuration of the index (preset, columns, meta character, skipped lines and the reference names)
+func (ix *Indexer) tabixConfig() []byte {
+	names := []byte{}
+	for _, reference := range ix.References {
+		names = append(names, []byte(reference.Name)...)
+		names = append(names, 0)
+	}
+
+	config := []byte{}
+	for _, value := range []int32{ix.Preset, 1, 2, 0, '#', 0, int32(len(names))} {
+		config = binary.LittleEndian.AppendUint32(config, uint32(value))
+	}
+	return append(config, names...)
+}
+
+// The smallest virtual offset of the records overlapping a bin (used by CSI indexes)
+func (ix *Indexer) binOffset(bin uint32, linear []uint64) uint64 {
+	if len(linear) == 0 {
+		return 0
+	}
+
+	// Find the level of the bin to determine the first window it covers
+	level := 0
+	first := uint32(0)
+	for ; level < ix.Depth; level++ {
+		next := first + 1<<(3*level)
+		if bin < next {
+			break
+		}
+		first = next
+	}
+	window := int64(bin-first) << (3 * (ix.Depth - level))
+	if bin >= pseudoBin(ix.Depth)-1 || window >= int64(len(linear)) {
+		return 0
+	}
+	return linear[window]
+}
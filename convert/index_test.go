@@ -0,0 +1,385 @@
+package bedgovcf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRegionToBin(t *testing.T) {
+	tests := []struct {
+		beg   int64
+		end   int64
+		depth int
+		bin   uint32
+	}{
+		{0, 1, 5, 4681},
+		{16384, 16385, 5, 4682},
+		{0, 16385, 5, 585},
+		{0, 1 << 29, 5, 0},
+		{1 << 30, 1<<30 + 1, 6, 37449 + 65536},
+	}
+	for _, test := range tests {
+		bin := regionToBin(test.beg, test.end, indexMinShift, test.depth)
+		if bin != test.bin {
+			t.Fatalf("Expected bin %v for %v-%v, got %v", test.bin, test.beg, test.end, bin)
+		}
+	}
+
+	if pseudoBin(tabixDepth) != 37450 {
+		t.Fatalf("Expected pseudo bin 37450, got %v", pseudoBin(tabixDepth))
+	}
+}
+
+func TestIndexerDepth(t *testing.T) {
+	// BCF indexes (preset 0) base the depth on the contig lengths, VCF indexes use the fixed depth of tabix
+	for _, test := range []struct {
+		maxLength int64
+		preset    int32
+		depth     int
+	}{
+		{248956422, 0, 5},
+		{1 << 30, 0, 6},
+		{248956422, 2, 6},
+		{1 << 33, 2, 7},
+	} {
+		indexer, err := newIndexer("csi", test.maxLength, test.preset)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if indexer.Depth != test.depth {
+			t.Fatalf("Expected a depth of %v for %v (preset %v), got %v", test.depth, test.maxLength, test.preset, indexer.Depth)
+		}
+	}
+
+	_, err := newIndexer("tbi", 1<<30, 2)
+	if err == nil {
+		t.Fatalf("Expected an error for contigs longer than 2^29 in a tabix index")
+	}
+}
+
+func TestIndexerUnsorted(t *testing.T) {
+	indexer, _ := newIndexer("tbi", 1000, 2)
+	indexer.add("chr1", 100, 101, bgzfPosition{}, bgzfPosition{Offset: 10})
+	if err := indexer.add("chr1", 50, 51, bgzfPosition{Offset: 10}, bgzfPosition{Offset: 20}); err == nil {
+		t.Fatalf("Expected an error for unsorted positions")
+	}
+
+	indexer, _ = newIndexer("tbi", 1000, 2)
+	indexer.add("chr1", 100, 101, bgzfPosition{}, bgzfPosition{Offset: 10})
+	indexer.add("chr2", 100, 101, bgzfPosition{Offset: 10}, bgzfPosition{Offset: 20})
+	if err := indexer.add("chr1", 200, 201, bgzfPosition{Offset: 20}, bgzfPosition{Offset: 30}); err == nil {
+		t.Fatalf("Expected an error for unsorted contigs")
+	}
+}
+
+func TestKhashOrder(t *testing.T) {
+	// 4687 and 4688 wrap around the table of 4 buckets, the table grows to 8 buckets on the last insert
+	order := khashOrder([]uint32{4687, 4688, 37450, 37450})
+	if !slices.Equal(order, []uint32{4688, 37450, 4687}) {
+		t.Fatalf("Expected the order 4688, 37450, 4687, got %v", order)
+	}
+
+	order = khashOrder([]uint32{4681, 4682, 4681, 37450, 37450})
+	if !slices.Equal(order, []uint32{4681, 4682, 37450}) {
+		t.Fatalf("Expected the order 4681, 4682, 37450, got %v", order)
+	}
+}
+
+func TestFinishBins(t *testing.T) {
+	// The block offsets are chosen so the chunks of bin 4683 span more than the marker distance
+	writer := &BgzfWriter{Offsets: []int64{0, 100, 0x20000, 0x30000}}
+	indexer, _ := newIndexer("tbi", 1000000, 2)
+	records := []struct {
+		beg   int64
+		end   int64
+		start bgzfPosition
+		stop  bgzfPosition
+	}{
+		{40000, 40001, bgzfPosition{0, 10}, bgzfPosition{0, 20}},
+		{40010, 50000, bgzfPosition{0, 20}, bgzfPosition{0, 30}},
+		{40020, 40021, bgzfPosition{0, 30}, bgzfPosition{1, 0}},
+		{60000, 60001, bgzfPosition{1, 0}, bgzfPosition{2, 0}},
+		{60010, 60011, bgzfPosition{2, 0}, bgzfPosition{3, 5}},
+	}
+	for _, record := range records {
+		if err := indexer.add("chr1", record.beg, record.end, record.start, record.stop); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	reference := indexer.References[0]
+	linear := reference.linearOffsets(writer)
+	// The windows before the first record point to the first record
+	first := writer.virtualOffset(bgzfPosition{0, 10})
+	expectedLinear := []uint64{first, first, first, writer.virtualOffset(bgzfPosition{0, 20})}
+	if !slices.Equal(linear, expectedLinear) {
+		t.Fatalf("Expected the linear index %v, got %v", expectedLinear, linear)
+	}
+
+	// Bin 4683 (32768-49151) spans less than the marker distance and is merged into its parent bin 585,
+	// after which the chunks in the same block are merged. Bin 4684 spans more than the marker distance
+	// The bins are written in the order of the hash table of htslib
+	bins := indexer.finishBins(reference, linear, writer)
+	// The offset of a bin is the linear index of its first window
+	expected := []indexBin{
+		{Bin: 585, Offset: linear[0], Chunks: [][2]uint64{{first, writer.virtualOffset(bgzfPosition{1, 0})}}},
+		{Bin: pseudoBin(tabixDepth)},
+		{Bin: 4684, Offset: linear[3], Chunks: [][2]uint64{{writer.virtualOffset(bgzfPosition{1, 0}), writer.virtualOffset(bgzfPosition{3, 5})}}},
+	}
+	if !reflect.DeepEqual(bins, expected) {
+		t.Fatalf("Expected the bins %v, got %v", expected, bins)
+	}
+}
+
+// A small reader for the little-endian fields of an index
+type indexReader struct {
+	data []byte
+}
+
+func (ir *indexReader) uint32() uint32 {
+	value := binary.LittleEndian.Uint32(ir.data)
+	ir.data = ir.data[4:]
+	return value
+}
+
+func (ir *indexReader) uint64() uint64 {
+	value := binary.LittleEndian.Uint64(ir.data)
+	ir.data = ir.data[8:]
+	return value
+}
+
+func TestTabixIndex(t *testing.T) {
+	for _, format := range []string{"tbi", "csi"} {
+		dir := t.TempDir()
+		var output bytes.Buffer
+		writer := newBgzfWriter(&output, 2)
+		indexer, err := newIndexer(format, 1000000, 2)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		fmt.Fprint(writer, "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+		records := map[string]int{"chr1": 3000, "chr2": 2000}
+		for _, chrom := range []string{"chr1", "chr2"} {
+			for i := 0; i < records[chrom]; i++ {
+				start := writer.position()
+				fmt.Fprintf(writer, "%v\t%v\t.\tA\tT\t.\tPASS\t.\n", chrom, i*100+1)
+				if err := indexer.add(chrom, int64(i*100), int64(i*100+1), start, writer.position()); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		path := filepath.Join(dir, "test.vcf.gz."+format)
+		if err := writeIndex(indexer, path, writer); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		defer file.Close()
+		reader, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("Expected the index to be gzip compressed, got %v", err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+
+		index := &indexReader{data: data}
+		magic := string(index.data[:4])
+		index.data = index.data[4:]
+		expectedMagic := map[string]string{"tbi": "TBI\x01", "csi": "CSI\x01"}[format]
+		if magic != expectedMagic {
+			t.Fatalf("Expected magic %q, got %q", expectedMagic, magic)
+		}
+
+		depth := tabixDepth
+		var references uint32
+		if format == "tbi" {
+			references = index.uint32()
+		} else {
+			if minShift := index.uint32(); minShift != indexMinShift {
+				t.Fatalf("Expected a min shift of %v, got %v", indexMinShift, minShift)
+			}
+			depth = int(index.uint32())
+			index.data = index.data[4:]
+		}
+		config := []uint32{}
+		for i := 0; i < 7; i++ {
+			config = append(config, index.uint32())
+		}
+		if config[0] != 2 || config[1] != 1 || config[2] != 2 || config[3] != 0 || config[4] != '#' {
+			t.Fatalf("Expected the VCF tabix configuration, got %v", config)
+		}
+		names := strings.Split(strings.TrimSuffix(string(index.data[:config[6]]), "\x00"), "\x00")
+		index.data = index.data[config[6]:]
+		if strings.Join(names, ",") != "chr1,chr2" {
+			t.Fatalf("Expected the names chr1,chr2, got %v", names)
+		}
+		if format == "csi" {
+			references = index.uint32()
+		}
+		if references != 2 {
+			t.Fatalf("Expected 2 references, got %v", references)
+		}
+
+		blocks, offsets := readBgzfBlocks(t, output.Bytes())
+		for _, name := range names {
+			bins := index.uint32()
+			found := false
+			for i := uint32(0); i < bins; i++ {
+				bin := index.uint32()
+				if format == "csi" {
+					index.uint64()
+				}
+				chunks := index.uint32()
+				for j := uint32(0); j < chunks; j++ {
+					start, end := index.uint64(), index.uint64()
+					if bin == pseudoBin(depth) {
+						if j == 1 {
+							if int(start) != records[name] {
+								t.Fatalf("Expected %v records for %v, got %v", records[name], name, start)
+							}
+							found = true
+						} else if !strings.HasPrefix(readAtVirtualOffset(blocks, offsets, start), name+"\t1\t") {
+							t.Fatalf("Expected the pseudo bin of %v to start at its first record", name)
+						}
+						continue
+					}
+					if start >= end || !strings.HasPrefix(readAtVirtualOffset(blocks, offsets, start), name+"\t") {
+						t.Fatalf("Expected chunk %v of bin %v on %v to start at a record", j, bin, name)
+					}
+				}
+			}
+			if !found {
+				t.Fatalf("Expected a pseudo bin for %v", name)
+			}
+			if format == "tbi" {
+				intervals := index.uint32()
+				for i := uint32(0); i < intervals; i++ {
+					offset := index.uint64()
+					// The first record of a window is the first record starting at or after the start of the window
+					first := (int(i)*(1<<indexMinShift) + 99) / 100
+					expected := fmt.Sprintf("%v\t%v\t", name, first*100+1)
+					if !strings.HasPrefix(readAtVirtualOffset(blocks, offsets, offset), expected) {
+						t.Fatalf("Expected linear index window %v of %v to point to %q", i, name, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Map an uncompressed offset of a BGZF file to a position, the end of a block is the start of the next one like in htslib
+func fixturePosition(sizes []int, offset int) bgzfPosition {
+	for block, size := range sizes {
+		if offset < size {
+			return bgzfPosition{Block: block, Offset: offset}
+		}
+		offset -= size
+	}
+	return bgzfPosition{Block: len(sizes) - 1, Offset: offset}
+}
+
+// Decompress a gzip compressed file
+func readGzip(t *testing.T, path string) []byte {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Expected %v to be gzip compressed, got %v", path, err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return data
+}
+
+func TestHtslibIndexFixtures(t *testing.T) {
+	data := readHtslibFixture(t, "index.vcf.gz")
+
+	blocks, offsets := readBgzfBlocks(t, data)
+	writer := &BgzfWriter{}
+	sizes := []int{}
+	content := []byte{}
+	for _, offset := range offsets {
+		writer.Offsets = append(writer.Offsets, int64(offset))
+		sizes = append(sizes, len(blocks[offset]))
+		content = append(content, blocks[offset]...)
+	}
+
+	// tabix uses the CSI depth of 6 unless a contig is longer than 2^32
+	maxLength := int64(0)
+	for _, line := range strings.Split(string(content), "\n") {
+		if _, length, ok := strings.Cut(line, ",length="); ok && strings.HasPrefix(line, "##contig=<") {
+			var parsed int64
+			fmt.Sscan(strings.TrimRight(length, ">"), &parsed)
+			maxLength = max(maxLength, parsed)
+		}
+	}
+
+	for _, format := range []string{"tbi", "csi"} {
+		indexer, err := newIndexer(format, maxLength, 2)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		start := 0
+		for _, line := range strings.SplitAfter(string(content), "\n") {
+			end := start + len(line)
+			if line != "" && !strings.HasPrefix(line, "#") {
+				fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+				variant := Variant{Chrom: fields[0], Pos: fields[1], Ref: fields[3]}
+				for _, info := range strings.Split(fields[7], ";") {
+					name, value, _ := strings.Cut(info, "=")
+					variant.Info = append(variant.Info, VariantInfoFormat{Name: name, Value: value})
+				}
+				beg, stop, err := variant.interval()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if err := indexer.add(variant.Chrom, beg, stop, fixturePosition(sizes, start), fixturePosition(sizes, end)); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			}
+			start = end
+		}
+
+		path := filepath.Join(t.TempDir(), "index.vcf.gz."+format)
+		if err := writeIndex(indexer, path, writer); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		expected := readGzip(t, "../test_data/htslib/index.vcf.gz."+format)
+		if index := readGzip(t, path); !bytes.Equal(index, expected) {
+			t.Fatalf("Expected the %v index to match the htslib fixture\nexpected %x\ngot      %x", format, expected, index)
+		}
+	}
+}
+
+// Write the index to its path, the BGZF writer of the indexed file is used to resolve the virtual offsets
+func writeIndex(indexer *Indexer, path string, writer *BgzfWriter) error {
+	file, err := indexer.create(path, nil, writer)
+	if err != nil {
+		return err
+	}
+	return file.Commit()
+}
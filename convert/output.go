@@ -0,0 +1,325 @@
+package bedgovcf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// The struct that writes a file to a temporary path next to the final path
+// The temporary file is only renamed to the final path when all data has been written successfully
+// Paths that aren't regular files (e.g. /dev/stdout or a named pipe) are written directly
+type AtomicFile struct {
+	Path      string        // The final path of the file
+	target    string        // The final path with its symlinks resolved, the temporary file is renamed to it
+	existing  bool          // Whether the final path already exists, its permissions are kept
+	mode      os.FileMode   // The permissions of the existing file
+	direct    bool          // Whether the data is written directly to the final path
+	file      *os.File      // The temporary file (or the final path when writing directly)
+	writer    *bufio.Writer // The buffered writer of the file
+	closed    bool          // Whether all data has been written and the file has been closed
+	committed bool          // Whether the file has been moved to its final path
+}
+
+// Create a temporary file in the directory of the final path
+func createAtomicFile(path string) (*AtomicFile, error) {
+	af := &AtomicFile{Path: path, target: path}
+	// A symlink is kept, the file it points to is replaced
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		af.target = target
+	}
+	info, err := os.Stat(af.target)
+	switch {
+	case filepath.Dir(path) == "/dev" || strings.HasPrefix(path, "/dev/fd/") || (err == nil && !info.Mode().IsRegular()):
+		af.direct = true
+	case err == nil:
+		af.existing = true
+		af.mode = info.Mode().Perm()
+	}
+
+	if af.direct {
+		af.file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	} else {
+		af.file, err = createTempFile(af.target)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the output file %v: %v", path, err)
+	}
+	af.writer = bufio.NewWriterSize(af.file, 256*1024)
+	return af, nil
+}
+
+// Create a new temporary file next to a path
+// Unlike os.CreateTemp, the file gets the permissions of a newly created file (0666 without the umask)
+func createTempFile(path string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(filepath.Dir(path), fmt.Sprintf(".%v.%v.tmp", filepath.Base(path), rand.Uint32()))
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return file, err
+	}
+}
+
+// Write data to the temporary file
+func (af *AtomicFile) Write(data []byte) (int, error) {
+	n, err := af.writer.Write(data)
+	if err != nil {
+		return n, fmt.Errorf("failed to write to the output file %v: %v", af.Path, err)
+	}
+	return n, nil
+}
+
+// Flush and close the temporary file without moving it to the final path
+func (af *AtomicFile) Close() error {
+	if af.closed {
+		return nil
+	}
+	if err := af.writer.Flush(); err != nil {
+		af.Abort()
+		return fmt.Errorf("failed to write to the output file %v: %v", af.Path, err)
+	}
+	if af.direct {
+		af.closed = true
+		if err := af.file.Close(); err != nil {
+			return fmt.Errorf("failed to close the output file %v: %v", af.Path, err)
+		}
+		return nil
+	}
+	if err := af.file.Sync(); err != nil {
+		af.Abort()
+		return fmt.Errorf("failed to write to the output file %v: %v", af.Path, err)
+	}
+	// An existing file keeps its permissions
+	if af.existing {
+		if err := af.file.Chmod(af.mode); err != nil {
+			af.Abort()
+			return fmt.Errorf("failed to set the permissions of the output file %v: %v", af.Path, err)
+		}
+	}
+	af.closed = true
+	if err := af.file.Close(); err != nil {
+		os.Remove(af.file.Name())
+		return fmt.Errorf("failed to close the output file %v: %v", af.Path, err)
+	}
+	return nil
+}
+
+// Flush and close the temporary file and move it to the final path
+func (af *AtomicFile) Commit() error {
+	if af.committed {
+		return nil
+	}
+	if err := af.Close(); err != nil {
+		return err
+	}
+	af.committed = true
+	if af.direct {
+		return nil
+	}
+	if err := os.Rename(af.file.Name(), af.target); err != nil {
+		os.Remove(af.file.Name())
+		return fmt.Errorf("failed to move the output file to %v: %v", af.Path, err)
+	}
+	return nil
+}
+
+// Remove the temporary file, nothing happens when the file has already been committed
+// Files that are written directly can't be restored, they are only closed
+func (af *AtomicFile) Abort() {
+	if af.committed {
+		return
+	}
+	if !af.closed {
+		af.file.Close()
+	}
+	if !af.direct {
+		os.Remove(af.file.Name())
+	}
+}
+
+// The struct that writes the header and records of one VCF or BCF file
+type VcfOutput struct {
+	Path        string        // The path of the output file (empty for stdout)
+	Problems    []error       // The problems found by the validator
+	Records     int           // The amount of written records
+	file        *AtomicFile   // The output file (nil for stdout)
+	stdout      *bufio.Writer // The buffered writer of stdout (nil for output files)
+	writer      io.Writer     // The writer the header and records are written to
+	bgzf        *BgzfWriter   // The BGZF writer (nil when the output isn't compressed)
+	encoder     *BcfEncoder   // The BCF encoder (nil for VCF output)
+	indexer     *Indexer      // The indexer (nil when no index is created)
+	indexFormat string        // The format of the index (tbi or csi)
+	indexNames  []string      // The contig order of the index (only for BCF)
+	index       *AtomicFile   // The finished index file (nil until the output is finished)
+	validator   *VcfValidator // The validator of the records (nil when --validate isn't given)
+	headerLines int           // The amount of header lines, used for the line numbers of the problems
+}
+
+// Create an output file (or stdout when the path is empty) and write the header
+func newVcfOutput(cCtx *cli.Context, path string, header Header, outputFormat string, indexFormat string) (*VcfOutput, error) {
+	logger := log.New(os.Stderr, "", 0)
+	vo := &VcfOutput{Path: path, indexFormat: indexFormat}
+
+	// The output is written to a temporary file that only replaces the output file when everything succeeded
+	if path != "" {
+		file, err := createAtomicFile(path)
+		if err != nil {
+			return nil, err
+		}
+		vo.file = file
+		vo.writer = file
+	} else {
+		vo.stdout = bufio.NewWriterSize(os.Stdout, 256*1024)
+		vo.writer = vo.stdout
+	}
+
+	// BCF files are always BGZF compressed
+	if outputFormat == "bcf" || cCtx.Bool("compress") || strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".bgz") {
+		vo.bgzf = newBgzfWriter(vo.writer, cCtx.Int("threads"))
+		vo.writer = vo.bgzf
+	}
+
+	// BCF indexes use the generic tabix preset and the contig order of the header
+	headerText := header.String()
+	headerData := []byte(headerText)
+	preset := int32(2)
+	if outputFormat == "bcf" {
+		vo.encoder = header.newBcfEncoder()
+		headerData = vo.encoder.header(header)
+		preset = 0
+		vo.indexNames = vo.encoder.Names
+	}
+
+	if indexFormat != "" {
+		indexer, err := newIndexer(indexFormat, header.maxContigLength(), preset)
+		if err != nil {
+			vo.abort()
+			return nil, err
+		}
+		vo.indexer = indexer
+	}
+
+	vo.headerLines = strings.Count(headerText, "\n")
+	if cCtx.Bool("validate") {
+		name := path
+		if name == "" {
+			name = "stdout"
+		}
+		vo.validator, vo.Problems = header.newVcfValidator(name, true)
+		for _, problem := range vo.Problems {
+			logger.Printf("WARNING: %v", problem)
+		}
+	}
+
+	if _, err := vo.writer.Write(headerData); err != nil {
+		vo.abort()
+		return nil, fmt.Errorf("failed to write the header: %v", err)
+	}
+	return vo, nil
+}
+
+// Write a record to the output
+func (vo *VcfOutput) write(variant Variant) error {
+	logger := log.New(os.Stderr, "", 0)
+	vo.Records++
+	if vo.validator != nil {
+		recordProblems := vo.validator.validate(variant, vo.headerLines+vo.Records)
+		for _, problem := range recordProblems {
+			logger.Printf("WARNING: %v", problem)
+		}
+		vo.Problems = append(vo.Problems, recordProblems...)
+	}
+
+	var start bgzfPosition
+	if vo.bgzf != nil {
+		start = vo.bgzf.position()
+	}
+	var record []byte
+	if vo.encoder != nil {
+		var err error
+		record, err = vo.encoder.encode(variant)
+		if err != nil {
+			return err
+		}
+	} else {
+		record = []byte(variant.String())
+	}
+	if _, err := vo.writer.Write(record); err != nil {
+		return fmt.Errorf("failed to write a record: %v", err)
+	}
+	if vo.indexer != nil {
+		beg, end, err := variant.interval()
+		if err != nil {
+			return err
+		}
+		return vo.indexer.add(variant.Chrom, beg, end, start, vo.bgzf.position())
+	}
+	return nil
+}
+
+// Write the remaining data and the index to temporary files without moving them to their paths
+// The output is aborted when validation problems were found
+func (vo *VcfOutput) finish() error {
+	if vo.bgzf != nil {
+		if err := vo.bgzf.Close(); err != nil {
+			vo.abort()
+			return err
+		}
+	}
+	if len(vo.Problems) != 0 {
+		vo.abort()
+		return fmt.Errorf("the validation of the output found %v problem(s)", len(vo.Problems))
+	}
+	if vo.file != nil {
+		if err := vo.file.Close(); err != nil {
+			return err
+		}
+	} else if err := vo.stdout.Flush(); err != nil {
+		return fmt.Errorf("failed to write to stdout: %v", err)
+	}
+	if vo.indexer != nil {
+		index, err := vo.indexer.create(fmt.Sprintf("%v.%v", vo.Path, vo.indexFormat), vo.indexNames, vo.bgzf)
+		if err != nil {
+			vo.abort()
+			return err
+		}
+		vo.index = index
+	}
+	return nil
+}
+
+// Move the finished output file and its index to their paths
+// The index is moved after the output file so it is never older than the file it indexes
+func (vo *VcfOutput) commit() error {
+	if vo.file != nil {
+		if err := vo.file.Commit(); err != nil {
+			return err
+		}
+	}
+	if vo.index != nil {
+		return vo.index.Commit()
+	}
+	return nil
+}
+
+// Remove the temporary output file, nothing happens when the output has already been closed
+func (vo *VcfOutput) abort() {
+	if vo.bgzf != nil {
+		vo.bgzf.Close()
+	}
+	if vo.index != nil {
+		vo.index.Abort()
+	}
+	if vo.file != nil {
+		vo.file.Abort()
+	}
+}
@@ -0,0 +1,116 @@
+package bedgovcf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.vcf")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// An aborted file doesn't replace the existing output
+	file, err := createAtomicFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := file.Write([]byte("partial")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	file.Abort()
+	content, _ := os.ReadFile(path)
+	if string(content) != "old\n" {
+		t.Fatalf("Expected the existing output to be kept, got %v", string(content))
+	}
+
+	file, err = createAtomicFile(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := file.Write([]byte("new\n")); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := file.Commit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	file.Abort()
+	content, _ = os.ReadFile(path)
+	if string(content) != "new\n" {
+		t.Fatalf("Expected the output to be replaced, got %v", string(content))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected no temporary files to be left, got %v files", len(entries))
+	}
+
+	if _, err := createAtomicFile(filepath.Join(dir, "missing", "test.vcf")); err == nil {
+		t.Fatalf("Expected an error for a missing directory, got none")
+	}
+}
+
+func TestAtomicFilePaths(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path string, content string) {
+		file, err := createAtomicFile(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		file.Write([]byte(content))
+		if err := file.Commit(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	// New files get the permissions of os.Create, existing files keep theirs
+	reference := filepath.Join(dir, "reference.vcf")
+	os.WriteFile(reference, nil, 0666)
+	expected, _ := os.Stat(reference)
+	path := filepath.Join(dir, "new.vcf")
+	write(path, "new\n")
+	if info, _ := os.Stat(path); info.Mode() != expected.Mode() {
+		t.Fatalf("Expected the permissions %v for a new file, got %v", expected.Mode(), info.Mode())
+	}
+	os.Chmod(path, 0600)
+	write(path, "replaced\n")
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the permissions 0600 to be kept, got %v", info.Mode())
+	}
+
+	// A symlink is kept and the file it points to is replaced
+	targetDir := filepath.Join(dir, "target")
+	os.Mkdir(targetDir, 0755)
+	target := filepath.Join(targetDir, "test.vcf")
+	os.WriteFile(target, []byte("old\n"), 0644)
+	link := filepath.Join(dir, "link.vcf")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+	write(link, "new\n")
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("Expected the symlink to be kept")
+	}
+	if content, _ := os.ReadFile(target); string(content) != "new\n" {
+		t.Fatalf("Expected the target of the symlink to be replaced, got %v", string(content))
+	}
+
+	// Files that aren't regular files are written directly
+	file, err := createAtomicFile(os.DevNull)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !file.direct {
+		t.Fatalf("Expected %v to be written directly", os.DevNull)
+	}
+	file.Write([]byte("data\n"))
+	if err := file.Commit(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info, _ := os.Stat(os.DevNull); info.Mode().IsRegular() {
+		t.Fatalf("Expected %v to be kept", os.DevNull)
+	}
+}
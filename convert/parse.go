@@ -0,0 +1,231 @@
+package bedgovcf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The struct that reads the header and records of a VCF file
+type VcfReader struct {
+	Path    string         // The path of the VCF file
+	Header  Header         // The header of the VCF file
+	Line    int            // The line number of the last read line (1-based)
+	file    *os.File       // The opened VCF file
+	scanner *bufio.Scanner // The scanner of the (decompressed) VCF file
+}
+
+// Open a (gzipped or BGZF compressed) VCF file and read its header
+func openVcf(path string) (*VcfReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the VCF file: %v", err)
+	}
+
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	magic, err := reader.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to decompress the VCF file: %v", err)
+		}
+		input = gzipReader
+	}
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	vr := &VcfReader{
+		Path:    path,
+		file:    file,
+		scanner: scanner,
+	}
+	if err := vr.readHeader(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return vr, nil
+}
+
+// Read the meta lines and the column header line
+func (vr *VcfReader) readHeader() error {
+	for vr.scanner.Scan() {
+		vr.Line++
+		line := vr.scanner.Text()
+		if strings.HasPrefix(line, "##fileformat=") {
+			vr.Header.Version = strings.TrimPrefix(strings.TrimPrefix(line, "##fileformat="), "VCFv")
+			continue
+		}
+		if strings.HasPrefix(line, "##") {
+			headerLine, err := parseHeaderLine(line)
+			if err != nil {
+				return &ConversionError{File: vr.Path, Line: vr.Line, Err: err}
+			}
+			vr.Header.HeaderLines = append(vr.Header.HeaderLines, headerLine)
+			continue
+		}
+		if !strings.HasPrefix(line, "#CHROM") {
+			return &ConversionError{File: vr.Path, Line: vr.Line, Err: errors.New("expected the #CHROM header line before the records")}
+		}
+
+		columns := strings.Split(line, "\t")
+		switch {
+		case len(columns) == 8:
+			vr.Header.SitesOnly = true
+		case len(columns) == 10:
+			vr.Header.Sample = columns[9]
+		case len(columns) > 10:
+			return &ConversionError{File: vr.Path, Line: vr.Line, Err: fmt.Errorf("files with more than one sample are not supported, found %v samples", len(columns)-9)}
+		default:
+			return &ConversionError{File: vr.Path, Line: vr.Line, Err: fmt.Errorf("expected 8 or 10 columns in the #CHROM header line, got %v", len(columns))}
+		}
+		return nil
+	}
+
+	if err := vr.scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the VCF file: %v", err)
+	}
+	return &ConversionError{File: vr.Path, Line: vr.Line, Err: errors.New("the #CHROM header line is missing")}
+}
+
+// Parse a meta line (e.g. ##INFO=<ID=END,Number=1,...> or ##source=bedgovcf)
+func parseHeaderLine(line string) (HeaderLine, error) {
+	key, value, ok := strings.Cut(strings.TrimPrefix(line, "##"), "=")
+	if !ok {
+		return HeaderLine{}, fmt.Errorf("the header line (%v) is not valid, expected ##key=value", line)
+	}
+	if !strings.HasPrefix(value, "<") || !strings.HasSuffix(value, ">") {
+		return HeaderLine{Category: key, Content: value}, nil
+	}
+
+	attributes, err := parseAttributes(value[1 : len(value)-1])
+	if err != nil {
+		return HeaderLine{}, fmt.Errorf("the header line (%v) is not valid: %v", line, err)
+	}
+
+	headerLine := HeaderLine{Category: key}
+	for _, attribute := range attributes {
+		headerLine.Attributes = append(headerLine.Attributes, HeaderAttribute{Key: attribute[0], Value: attribute[1]})
+	}
+	return headerLine, nil
+}
+
+// Split the attributes of a structured meta line into key value pairs in their order, quoted values are unescaped
+func parseAttributes(input string) ([][2]string, error) {
+	attributes := [][2]string{}
+	for len(input) != 0 {
+		key, rest, ok := strings.Cut(input, "=")
+		if !ok {
+			return nil, fmt.Errorf("the attribute (%v) has no value", input)
+		}
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, "\"") {
+			closed := false
+			i := 1
+			for ; i < len(rest); i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					value.WriteByte(rest[i])
+				} else if rest[i] == '"' {
+					closed = true
+					break
+				} else {
+					value.WriteByte(rest[i])
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("the value of %v is not closed by a double quote", key)
+			}
+			rest = rest[i+1:]
+		} else {
+			// Commas inside square brackets are part of the value (e.g. Values=[WholeGenome, Exome])
+			end := len(rest)
+			depth := 0
+			for i, character := range rest {
+				if character == '[' {
+					depth++
+				} else if character == ']' && depth > 0 {
+					depth--
+				} else if character == ',' && depth == 0 {
+					end = i
+					break
+				}
+			}
+			value.WriteString(rest[:end])
+			rest = rest[end:]
+		}
+
+		attributes = append(attributes, [2]string{key, value.String()})
+		if rest != "" && !strings.HasPrefix(rest, ",") {
+			return nil, fmt.Errorf("expected a comma after the value of %v", key)
+		}
+		input = strings.TrimPrefix(rest, ",")
+	}
+	return attributes, nil
+}
+
+// Read the next record, returns false when all records have been read
+func (vr *VcfReader) next() (Variant, bool, error) {
+	if !vr.scanner.Scan() {
+		if err := vr.scanner.Err(); err != nil {
+			return Variant{}, false, fmt.Errorf("failed to read the VCF file: %v", err)
+		}
+		return Variant{}, false, nil
+	}
+	vr.Line++
+
+	columns := strings.Split(vr.scanner.Text(), "\t")
+	expected := 10
+	if vr.Header.SitesOnly {
+		expected = 8
+	}
+	if len(columns) != expected {
+		return Variant{}, false, &ConversionError{File: vr.Path, Line: vr.Line, Err: fmt.Errorf("expected %v columns, got %v", expected, len(columns))}
+	}
+
+	variant := Variant{
+		Chrom:  columns[0],
+		Pos:    columns[1],
+		Id:     columns[2],
+		Ref:    columns[3],
+		Alt:    columns[4],
+		Qual:   columns[5],
+		Filter: columns[6],
+	}
+
+	if columns[7] != "." {
+		for _, field := range strings.Split(columns[7], ";") {
+			name, value, _ := strings.Cut(field, "=")
+			variant.Info = append(variant.Info, VariantInfoFormat{Name: name, Value: value})
+		}
+	}
+
+	if !vr.Header.SitesOnly {
+		keys := strings.Split(columns[8], ":")
+		values := strings.Split(columns[9], ":")
+		if len(values) > len(keys) {
+			return Variant{}, false, &ConversionError{File: vr.Path, Line: vr.Line, Field: "FORMAT", Err: fmt.Errorf("the sample has %v values for %v FORMAT keys", len(values), len(keys))}
+		}
+		for i, key := range keys {
+			// Trailing FORMAT values can be left out
+			value := "."
+			if i < len(values) {
+				value = values[i]
+			}
+			variant.Format = append(variant.Format, VariantInfoFormat{Name: key, Value: value})
+		}
+	}
+
+	return variant, true, nil
+}
+
+// Close the VCF file
+func (vr *VcfReader) Close() error {
+	return vr.file.Close()
+}
@@ -0,0 +1,75 @@
+package bedgovcf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHeaderLine(t *testing.T) {
+	line, err := parseHeaderLine(`##INFO=<ID=NOTE,Number=1,Type=String,Description="A \"quoted\", C:\\path">`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := newHeaderLine("INFO", "ID", "NOTE", "Number", "1", "Type", "String", "Description", `A "quoted", C:\path`)
+	if !reflect.DeepEqual(line, expected) {
+		t.Fatalf("Expected %v, got %v", expected, line)
+	}
+	if line.String() != `##INFO=<ID=NOTE,Number=1,Type=String,Description="A \"quoted\", C:\\path">` {
+		t.Fatalf("Expected the header line to round-trip, got %v", line.String())
+	}
+
+	line, err = parseHeaderLine("##contig=<ID=chr1,length=248956422,assembly=GRCh38>")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if line.id() != "chr1" || line.get("length") != "248956422" || line.get("assembly") != "GRCh38" {
+		t.Fatalf("Expected the contig attributes to be parsed, got %v", line)
+	}
+
+	line, err = parseHeaderLine("##source=bedgovcf")
+	if err != nil || line.Category != "source" || line.Content != "bedgovcf" {
+		t.Fatalf("Expected a generic header line, got %v (%v)", line, err)
+	}
+
+	if _, err := parseHeaderLine(`##INFO=<ID=X,Description="not closed>`); err == nil {
+		t.Fatalf("Expected an error for an unclosed quote")
+	}
+}
+
+func TestReadVcf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.vcf")
+	content := "##fileformat=VCFv4.3\n" +
+		"##INFO=<ID=END,Number=1,Type=Integer,Description=\"End\">\n" +
+		"##INFO=<ID=IMPRECISE,Number=0,Type=Flag,Description=\"Imprecise\">\n" +
+		"##FORMAT=<ID=GT,Number=1,Type=String,Description=\"Genotype\">\n" +
+		"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\tsample\n" +
+		"chr1\t10\tid_0\tN\t<DEL>\t.\tPASS\tEND=20;IMPRECISE\tGT\t0/1\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reader, err := openVcf(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer reader.Close()
+
+	if reader.Header.Version != "4.3" || reader.Header.Sample != "sample" || len(reader.Header.HeaderLines) != 3 {
+		t.Fatalf("Expected the header to be parsed, got %v", reader.Header)
+	}
+
+	variant, ok, err := reader.next()
+	if err != nil || !ok {
+		t.Fatalf("Expected a record, got %v (%v)", ok, err)
+	}
+	if reader.Line != 6 || variant.Id != "id_0" || len(variant.Info) != 2 || variant.Info[1].Name != "IMPRECISE" || variant.Format[0].Value != "0/1" {
+		t.Fatalf("Expected the record to be parsed, got %v", variant)
+	}
+
+	_, ok, err = reader.next()
+	if err != nil || ok {
+		t.Fatalf("Expected no more records, got %v (%v)", ok, err)
+	}
+}
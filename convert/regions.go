@@ -0,0 +1,194 @@
+package bedgovcf
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// The struct for one genomic region (0-based, half-open)
+type Region struct {
+	Chrom string // The chromosome of the region
+	Start int64  // The start of the region
+	End   int64  // The end of the region
+}
+
+// The selection of regions to convert
+type RegionSelection struct {
+	Regions map[string][]Region // The regions per chromosome
+	Order   []string            // The chromosomes in the order they were selected
+	Mode    string              // How rows are matched to the regions (overlap or start)
+}
+
+// Read the selected regions from the command line, returns nil when no regions were selected
+func readRegions(cCtx *cli.Context) (*RegionSelection, error) {
+	if len(cCtx.StringSlice("region")) == 0 && cCtx.String("regions-file") == "" && len(cCtx.StringSlice("contigs")) == 0 {
+		return nil, nil
+	}
+
+	selection := &RegionSelection{
+		Regions: map[string][]Region{},
+		Mode:    "overlap",
+	}
+	if cCtx.String("region-mode") != "" {
+		selection.Mode = cCtx.String("region-mode")
+	}
+	if selection.Mode != "overlap" && selection.Mode != "start" {
+		return nil, fmt.Errorf("the region mode (%v) is not supported, use 'overlap' or 'start'", selection.Mode)
+	}
+
+	for _, v := range cCtx.StringSlice("contigs") {
+		selection.add(Region{Chrom: v, Start: 0, End: math.MaxInt64})
+	}
+
+	for _, v := range cCtx.StringSlice("region") {
+		region, err := parseRegion(v)
+		if err != nil {
+			return nil, err
+		}
+		selection.add(region)
+	}
+
+	if cCtx.String("regions-file") != "" {
+		err := selection.readRegionsFile(cCtx.String("regions-file"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return selection, nil
+}
+
+// Parse a region string (chr, chr:start or chr:start-end, 1-based and inclusive)
+func parseRegion(region string) (Region, error) {
+	separator := strings.LastIndex(region, ":")
+	if separator == -1 {
+		return Region{Chrom: region, Start: 0, End: math.MaxInt64}, nil
+	}
+
+	chrom := region[:separator]
+	coordinates := strings.Split(strings.ReplaceAll(region[separator+1:], ",", ""), "-")
+	start, err := strconv.ParseInt(coordinates[0], 10, 64)
+	if err != nil || len(coordinates) > 2 {
+		return Region{}, fmt.Errorf("failed to parse the region (%v), it should look like chr:start-end", region)
+	}
+
+	end := int64(math.MaxInt64)
+	if len(coordinates) == 2 && coordinates[1] != "" {
+		end, err = strconv.ParseInt(coordinates[1], 10, 64)
+		if err != nil {
+			return Region{}, fmt.Errorf("failed to parse the region (%v), it should look like chr:start-end", region)
+		}
+	}
+
+	if start < 1 || end < start {
+		return Region{}, fmt.Errorf("the region (%v) is invalid, the start should be at least 1 and not be larger than the end", region)
+	}
+
+	return Region{Chrom: chrom, Start: start - 1, End: end}, nil
+}
+
+// Read the regions from a BED file
+func (r *RegionSelection) readRegionsFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the regions file: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "track") || strings.HasPrefix(text, "browser") {
+			continue
+		}
+
+		line := strings.Split(text, "\t")
+		if len(line) < 3 {
+			return &ConversionError{File: path, Line: lineNumber, Err: fmt.Errorf("expected at least 3 columns, got %v", len(line))}
+		}
+		start, err := strconv.ParseInt(line[1], 10, 64)
+		if err != nil {
+			return &ConversionError{File: path, Line: lineNumber, Err: fmt.Errorf("failed to parse the start (%v) to an integer", line[1])}
+		}
+		end, err := strconv.ParseInt(line[2], 10, 64)
+		if err != nil {
+			return &ConversionError{File: path, Line: lineNumber, Err: fmt.Errorf("failed to parse the end (%v) to an integer", line[2])}
+		}
+		r.add(Region{Chrom: line[0], Start: start, End: end})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the regions file: %v", err)
+	}
+	return nil
+}
+
+// Add a region to the selection
+func (r *RegionSelection) add(region Region) {
+	if _, ok := r.Regions[region.Chrom]; !ok {
+		r.Order = append(r.Order, region.Chrom)
+	}
+	r.Regions[region.Chrom] = append(r.Regions[region.Chrom], region)
+}
+
+// Translate the chromosome names of the selection with the chromosome mapper
+func (r *RegionSelection) mapChroms(mapper *ChromMapper) {
+	if r == nil || mapper == nil {
+		return
+	}
+	regions, order := r.Regions, r.Order
+	r.Regions = map[string][]Region{}
+	r.Order = nil
+	for _, chrom := range order {
+		name, _ := mapper.mapChrom(chrom)
+		for _, region := range regions[chrom] {
+			region.Chrom = name
+			r.add(region)
+		}
+	}
+}
+
+// Check if a contig is part of the selection
+func (r *RegionSelection) hasContig(chrom string) bool {
+	_, ok := r.Regions[chrom]
+	return ok
+}
+
+// Check if an interval (0-based, half-open) is part of the selection
+func (r *RegionSelection) contains(chrom string, start int64, end int64) bool {
+	for _, region := range r.Regions[chrom] {
+		switch r.Mode {
+		case "start":
+			if start >= region.Start && start < region.End {
+				return true
+			}
+		default:
+			// Treat empty intervals as one base long so they can still overlap
+			if end <= start {
+				end = start + 1
+			}
+			if start < region.End && end > region.Start {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check if a record lies within the selection
+// The record is matched on its final CHROM and its interval (POS up to INFO/END or the length of REF)
+func (r *RegionSelection) containsVariant(variant Variant) (bool, error) {
+	start, end, err := variant.interval()
+	if err != nil {
+		return false, &ConversionError{Field: "POS", Err: err}
+	}
+	return r.contains(variant.Chrom, start, end), nil
+}
@@ -0,0 +1,138 @@
+package bedgovcf
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestParseRegion(t *testing.T) {
+	region, _ := parseRegion("chr1:1,001-2000")
+	expected := Region{Chrom: "chr1", Start: 1000, End: 2000}
+	if region != expected {
+		t.Fatalf("Expected region to be %v, got %v", expected, region)
+	}
+
+	region, _ = parseRegion("chrX")
+	expected = Region{Chrom: "chrX", Start: 0, End: math.MaxInt64}
+	if region != expected {
+		t.Fatalf("Expected region to be %v, got %v", expected, region)
+	}
+
+	region, _ = parseRegion("chr2:500")
+	expected = Region{Chrom: "chr2", Start: 499, End: math.MaxInt64}
+	if region != expected {
+		t.Fatalf("Expected region to be %v, got %v", expected, region)
+	}
+
+	_, err := parseRegion("chr1:2000-1000")
+	if err == nil {
+		t.Fatalf("Expected an error for a region with the end before the start")
+	}
+
+	_, err = parseRegion("chr1:a-b")
+	if err == nil {
+		t.Fatalf("Expected an error for a region with invalid coordinates")
+	}
+}
+
+func TestRegionContains(t *testing.T) {
+	selection := &RegionSelection{Regions: map[string][]Region{}, Mode: "overlap"}
+	selection.add(Region{Chrom: "chr1", Start: 1000, End: 2000})
+
+	if !selection.contains("chr1", 500, 1500) {
+		t.Fatalf("Expected chr1:500-1500 to overlap chr1:1000-2000")
+	}
+	if selection.contains("chr1", 2000, 2500) {
+		t.Fatalf("Expected chr1:2000-2500 not to overlap chr1:1000-2000")
+	}
+	if selection.contains("chr2", 1000, 2000) {
+		t.Fatalf("Expected chr2 not to be selected")
+	}
+
+	selection.Mode = "start"
+	if selection.contains("chr1", 500, 1500) {
+		t.Fatalf("Expected chr1:500-1500 not to start within chr1:1000-2000")
+	}
+	if !selection.contains("chr1", 1500, 2500) {
+		t.Fatalf("Expected chr1:1500-2500 to start within chr1:1000-2000")
+	}
+}
+
+func TestRestrictContigs(t *testing.T) {
+	header := Header{}
+	addTestContigs(t, &header)
+	selection := &RegionSelection{Regions: map[string][]Region{}}
+	selection.add(Region{Chrom: "chr2", Start: 0, End: math.MaxInt64})
+	header.restrictContigs(selection)
+	if len(header.HeaderLines) != 1 || header.HeaderLines[0].id() != "chr2" {
+		t.Fatalf("Expected only the chr2 contig to be kept, got %v", header.HeaderLines)
+	}
+}
+
+func TestRestrictContigsWithChromConvention(t *testing.T) {
+	for _, contig := range []string{"1", "chr1"} {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String("bed", "../test_data/test.bed", "")
+		set.String("fai", "../test_data/test.fai", "")
+		set.String("chrom-convention", "ensembl", "")
+		set.Bool("restrict-contigs", true, "")
+		set.Bool("no-date", true, "")
+		set.Bool("no-command", true, "")
+		set.Var(cli.NewStringSlice(contig), "contigs", "")
+		cCtx := cli.NewContext(&cli.App{}, set, nil)
+
+		config := Config{}
+		if err := config.validate(); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		vcf := Vcf{}
+		if err := vcf.SetHeader(cCtx, config); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		contigs := []string{}
+		for _, v := range vcf.Header.HeaderLines {
+			if v.Category == "contig" {
+				contigs = append(contigs, v.id())
+			}
+		}
+		if len(contigs) != 1 || contigs[0] != "1" {
+			t.Fatalf("Expected only contig 1 in the header for --contigs %v, got %v", contig, contigs)
+		}
+
+		if err := vcf.AddVariants(cCtx, config); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(vcf.Variants) != 2 || vcf.Variants[0].Chrom != "1" || vcf.Variants[1].Chrom != "1" {
+			t.Fatalf("Expected the two rows on chromosome 1 for --contigs %v, got %v", contig, vcf.Variants)
+		}
+	}
+}
+
+func TestRegionsResolvedRecord(t *testing.T) {
+	bed := filepath.Join(t.TempDir(), "test.bed")
+	if err := os.WriteFile(bed, []byte("1\t1\t50\n1\t1000\t1050\n2\t1000\t1050\n"), 0644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("bed", bed, "")
+	set.Var(cli.NewStringSlice("chr1:1000-2000"), "region", "")
+	cCtx := cli.NewContext(&cli.App{}, set, nil)
+
+	// The regions are matched against the CHROM with its prefix and the POS of the expression
+	config := Config{Chrom: ConfigStandardFieldStruct{Prefix: "chr", Value: "$0"}, Pos: ConfigStandardFieldStruct{Value: "~sum $1 1"}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	vcf := Vcf{}
+	if err := vcf.AddVariants(cCtx, config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(vcf.Variants) != 1 || vcf.Variants[0].Chrom != "chr1" || vcf.Variants[0].Pos != "1001" {
+		t.Fatalf("Expected only the record at chr1:1001, got %v", vcf.Variants)
+	}
+}
@@ -0,0 +1,192 @@
+package bedgovcf
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// The input files of which the checksums are embedded in the header, by the name of their flag
+var embeddedInputs = []string{"bed", "fai", "dict", "fasta", "header-template", "regions-file", "chrom-map"}
+
+// The flags that change the records, the contigs, the header or the output files, their values are embedded in the header and used again by replay
+var embeddedFlags = []string{
+	"sample", "skip", "header", "region", "contigs", "region-mode", "restrict-contigs", "chrom-convention",
+	"expect-assembly", "assembly-policy", "write-assembly", "contig-policy", "error-policy", "duplicate-ids", "sort", "sites-only",
+	"split-by", "split-restrict-contigs", "no-source", "no-date", "no-command", "no-reference", "vcf-version", "md5", "assembly",
+}
+
+// Add the normalized config (base64 encoded YAML), the checksums of the input files and the flag values to the header
+func (h *Header) embedConfig(cCtx *cli.Context, config Config) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to embed the config: %v", err)
+	}
+	h.addLine(HeaderLine{Category: "bedgovcfConfig", Content: base64.StdEncoding.EncodeToString(data)})
+
+	for _, name := range embeddedInputs {
+		path := cCtx.String(name)
+		if path == "" {
+			continue
+		}
+		digest, err := fileDigest(path)
+		if err != nil {
+			return err
+		}
+		h.addLine(newHeaderLine("bedgovcfInput", "ID", name, "File", filepath.Base(path), "SHA256", digest))
+	}
+
+	// The sample and VCF version are embedded as they were used, they can also come from the BED path and the config
+	for _, name := range embeddedFlags {
+		values := flagValues(cCtx, name)
+		switch name {
+		case "sample":
+			values = []string{h.Sample}
+		case "vcf-version":
+			values = []string{h.Version}
+		}
+		for _, value := range values {
+			h.addLine(newHeaderLine("bedgovcfFlag", "ID", name, "Value", value))
+		}
+	}
+	return nil
+}
+
+// Get the values of a flag as strings, flags that can be given multiple times can have several values
+func flagValues(cCtx *cli.Context, name string) []string {
+	switch value := cCtx.Value(name).(type) {
+	case nil:
+		return nil
+	case cli.StringSlice:
+		return value.Value()
+	default:
+		return []string{fmt.Sprint(value)}
+	}
+}
+
+// Use the embedded flag values for the flags that aren't given on the command line
+// A flag that is given with another value is kept, but the output can differ from the original
+func applyFlags(cCtx *cli.Context, embedded map[string][]string) error {
+	logger := log.New(os.Stderr, "", 0)
+	for _, name := range embeddedFlags {
+		values := embedded[name]
+		if cCtx.IsSet(name) {
+			if given := flagValues(cCtx, name); !slices.Equal(given, values) {
+				logger.Printf("WARNING: --%v is %v, but the VCF was created with %v, the output can differ from the original", name, strings.Join(given, ","), strings.Join(values, ","))
+			}
+			continue
+		}
+		for _, value := range values {
+			if err := cCtx.Set(name, value); err != nil {
+				return fmt.Errorf("failed to use the embedded value (%v) of --%v: %v", value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Calculate the SHA-256 checksum of a file
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %v to calculate its checksum: %v", path, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read %v to calculate its checksum: %v", path, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Read the embedded config of the VCF given as the first argument
+// The input files given on the command line are checked against the checksums in the header
+func ReplayConfig(cCtx *cli.Context) (Config, error) {
+	logger := log.New(os.Stderr, "", 0)
+	if cCtx.Args().Len() != 1 {
+		return Config{}, errors.New("expected one VCF file to replay")
+	}
+
+	reader, err := openVcf(cCtx.Args().First())
+	if err != nil {
+		return Config{}, err
+	}
+	defer reader.Close()
+
+	var config *Config
+	recorded := map[string]bool{}
+	flags := map[string][]string{}
+	for _, v := range reader.Header.HeaderLines {
+		switch v.Category {
+		case "bedgovcfConfig":
+			data, err := base64.StdEncoding.DecodeString(v.Content)
+			if err != nil {
+				return Config{}, fmt.Errorf("failed to decode the embedded config: %v", err)
+			}
+			config = &Config{}
+			if err := yaml.Unmarshal(data, config); err != nil {
+				return Config{}, fmt.Errorf("failed to read the embedded config: %v", err)
+			}
+		case "bedgovcfInput":
+			name, err := checkInput(cCtx, v)
+			if err != nil {
+				return Config{}, err
+			}
+			recorded[name] = true
+		case "bedgovcfFlag":
+			flags[v.id()] = append(flags[v.id()], v.get("Value"))
+		case "bedgovcfCommand":
+			logger.Printf("The VCF was created with: %v", v.Content)
+		}
+	}
+	if config == nil {
+		return Config{}, fmt.Errorf("the VCF file %v has no embedded config, it has to be created with --embed-config", reader.Path)
+	}
+
+	// VCFs created before the flags were embedded only have the config
+	if len(flags) != 0 {
+		if err := applyFlags(cCtx, flags); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, name := range embeddedInputs {
+		if cCtx.String(name) != "" && !recorded[name] {
+			logger.Printf("WARNING: the VCF was not created from a --%v file, the output can differ from the original", name)
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("the embedded config is not valid: %v", err)
+	}
+	return *config, nil
+}
+
+// Check if the input file given with the flag of an embedded input line matches the recorded checksum, returns the name of the flag
+func checkInput(cCtx *cli.Context, line HeaderLine) (string, error) {
+	name := line.id()
+	path := cCtx.String(name)
+	if path == "" {
+		return "", fmt.Errorf("the VCF was created from the %v file %v, give it with --%v", name, line.get("File"), name)
+	}
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+	if digest != line.get("SHA256") {
+		return "", fmt.Errorf("the checksum of %v (%v) doesn't match the checksum of the %v file the VCF was created from (%v, %v)", path, digest, name, line.get("File"), line.get("SHA256"))
+	}
+	return name, nil
+}
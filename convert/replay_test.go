@@ -0,0 +1,129 @@
+package bedgovcf
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+func replayContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, name := range embeddedInputs {
+		set.String(name, "", "")
+	}
+	for _, name := range embeddedFlags {
+		switch name {
+		case "skip":
+			set.Int64(name, 0, "")
+		case "header", "restrict-contigs", "write-assembly", "sort", "sites-only", "split-restrict-contigs", "no-source", "no-date", "no-command", "no-reference", "md5":
+			set.Bool(name, false, "")
+		case "region", "contigs":
+			set.Var(cli.NewStringSlice(), name, "")
+		default:
+			set.String(name, "", "")
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	return cli.NewContext(&cli.App{}, set, nil)
+}
+
+func TestReplayConfig(t *testing.T) {
+	dir := t.TempDir()
+	bed := filepath.Join(dir, "test.bed")
+	other := filepath.Join(dir, "other.bed")
+	vcf := filepath.Join(dir, "test.vcf")
+	os.WriteFile(bed, []byte("chr1\t1\t50\n"), 0644)
+	os.WriteFile(other, []byte("chr1\t1\t51\n"), 0644)
+
+	config := Config{Id: ConfigStandardFieldStruct{Prefix: "test_"}, Info: SliceConfigInfoFormatStruct{{Name: "END", Value: "$2"}}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	header := Header{Version: "4.2", Sample: "patient", SitesOnly: true}
+	if err := header.embedConfig(replayContext(t, "--bed", bed, "--region", "chr1:1-10", "--region", "chr2", "--sort"), config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, line := range []string{"##bedgovcfInput=<ID=bed,File=test.bed,", "##bedgovcfFlag=<ID=sample,Value=patient>", "##bedgovcfFlag=<ID=region,Value=chr2>", "##bedgovcfFlag=<ID=sort,Value=true>", "##bedgovcfFlag=<ID=vcf-version,Value=4.2>"} {
+		if !strings.Contains(header.String(), line) {
+			t.Fatalf("Expected the header line %v, got %v", line, header.String())
+		}
+	}
+	os.WriteFile(vcf, []byte(header.String()), 0644)
+
+	// The embedded flag values are used unless the flag is given
+	cCtx := replayContext(t, "--bed", bed, "--sample", "other", vcf)
+	replayed, err := ReplayConfig(cCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if replayed.Id.Prefix != "test_" || len(replayed.Info) != 1 || replayed.Info[0].Value != "$2" || replayed.Rounding != "round" {
+		t.Fatalf("Expected the embedded config, got %v", replayed)
+	}
+	if !slices.Equal(cCtx.StringSlice("region"), []string{"chr1:1-10", "chr2"}) || !cCtx.Bool("sort") || cCtx.String("vcf-version") != "4.2" {
+		t.Fatalf("Expected the embedded regions, --sort and the VCF version, got %v, %v and %v", cCtx.StringSlice("region"), cCtx.Bool("sort"), cCtx.String("vcf-version"))
+	}
+	if cCtx.String("sample") != "other" {
+		t.Fatalf("Expected the given sample to be kept, got %v", cCtx.String("sample"))
+	}
+
+	if _, err := ReplayConfig(replayContext(t, "--bed", other, vcf)); err == nil {
+		t.Fatalf("Expected an error for a BED file with a different checksum, got none")
+	}
+	if _, err := ReplayConfig(replayContext(t, vcf)); err == nil {
+		t.Fatalf("Expected an error when the BED file isn't given, got none")
+	}
+}
+
+func TestReplayAssembly(t *testing.T) {
+	dir := t.TempDir()
+	bed := filepath.Join(dir, "test.bed")
+	vcf := filepath.Join(dir, "test.vcf")
+	os.WriteFile(bed, []byte("chr1\t1\t50\n"), 0644)
+
+	config := Config{}
+	if err := config.validate(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	original := Vcf{}
+	if err := original.SetHeader(replayContext(t, "--bed", bed, "--assembly", "GRCh38", "--no-date", "--no-command"), config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := original.Header.embedConfig(replayContext(t, "--bed", bed, "--assembly", "GRCh38", "--no-date", "--no-command"), config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	os.WriteFile(vcf, []byte(original.Header.String()), 0644)
+
+	// The contigs of the assembly are used again without giving --assembly
+	cCtx := replayContext(t, "--bed", bed, vcf)
+	replayed, err := ReplayConfig(cCtx)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cCtx.String("assembly") != "GRCh38" || !cCtx.Bool("no-date") {
+		t.Fatalf("Expected the embedded --assembly and --no-date, got %v and %v", cCtx.String("assembly"), cCtx.Bool("no-date"))
+	}
+	result := Vcf{}
+	if err := result.SetHeader(cCtx, replayed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	contigs := func(header Header) []string {
+		names := []string{}
+		for _, v := range header.HeaderLines {
+			if v.Category == "contig" {
+				names = append(names, v.String())
+			}
+		}
+		return names
+	}
+	if expected := contigs(original.Header); len(expected) == 0 || !slices.Equal(contigs(result.Header), expected) {
+		t.Fatalf("Expected the contigs of GRCh38, got %v", contigs(result.Header))
+	}
+}
@@ -2,7 +2,6 @@ package bedgovcf
 
 import (
 	"fmt"
-	"log"
 	"math"
 	"slices"
 	"strconv"
@@ -38,6 +37,9 @@ func resolveField(configValues []string, bedValues []string, bedHeader []string)
 	switch function {
 	case "round":
 		// ~round <value>
+		if err := checkArguments(function, input, 1); err != nil {
+			return "", err
+		}
 		float, err := strconv.ParseFloat(input[1], 64)
 		if err != nil {
 			return "", fmt.Errorf("failed to parse the value (%v) to a float: %v", input[1], err)
@@ -61,6 +63,9 @@ func resolveField(configValues []string, bedValues []string, bedHeader []string)
 		return strconv.FormatFloat(sum, 'f', -1, 64), nil
 	case "min":
 		// ~min <startValue> <valueToSubstract1> <valueToSubstract2> ...
+		if err := checkArguments(function, input, 1); err != nil {
+			return "", err
+		}
 		min, err := strconv.ParseFloat(input[1], 64)
 		if err != nil {
 			return "", fmt.Errorf("failed to parse the value (%v) to a float: %v", input[1], err)
@@ -68,7 +73,7 @@ func resolveField(configValues []string, bedValues []string, bedHeader []string)
 		for _, v := range input[2:] {
 			float, err := strconv.ParseFloat(v, 64)
 			if err != nil {
-				log.Fatalf("Failed to parse the value (%v) to a float: %v", v, err)
+				return "", fmt.Errorf("failed to parse the value (%v) to a float: %v", v, err)
 			}
 			min -= float
 		}
@@ -76,71 +81,118 @@ func resolveField(configValues []string, bedValues []string, bedHeader []string)
 	case "if":
 		// ~if <value1> <operator> <value2> <value_if_true> <value_if_false>
 		// supported operators: > < >= <= ==
+		if err := checkArguments(function, input, 5); err != nil {
+			return "", err
+		}
 		v1 := input[1]
 		operator := input[2]
 		v2 := input[3]
 		vTrue := input[4]
 		vFalse := input[5:]
 
-		floatV1, err1 := strconv.ParseFloat(v1, 64)
-		floatV2, err2 := strconv.ParseFloat(v2, 64)
-
-		floatOperators := []string{"<", ">", "<=", ">="}
-		if slices.Contains(floatOperators, operator) && (err1 != nil || err2 != nil) {
-			return "", fmt.Errorf("failed to parse the values (%v and %v) to a float: %v and %v", v1, v2, err1, err2)
+		result, err := compareValues(v1, operator, v2)
+		if err != nil {
+			return "", err
+		}
+		if result {
+			return vTrue, nil
 		}
 
-		vFalseResolved := ""
-		var err error
 		if strings.HasPrefix(vFalse[0], "~") {
-			vFalseResolved, err = resolveField(vFalse, bedValues, bedHeader)
-			if err != nil {
-				return "", err
-			}
-		} else {
-			vFalseResolved = strings.Join(vFalse, " ")
+			return resolveField(vFalse, bedValues, bedHeader)
 		}
+		return strings.Join(vFalse, " "), nil
+	}
 
-		switch operator {
-		case "<":
-			if floatV1 < floatV2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
-			}
-		case ">":
-			if floatV1 > floatV2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
-			}
-		case ">=":
-			if floatV1 >= floatV2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
+	err := fmt.Errorf("the function %v is not supported", function)
+	return "", err
+}
+
+// Check if the function received at least the minimum amount of arguments
+func checkArguments(function string, input []string, minimum int) error {
+	if len(input)-1 < minimum {
+		return fmt.Errorf("the function ~%v expects at least %v argument(s), got %v", function, minimum, len(input)-1)
+	}
+	return nil
+}
+
+// Compare two values with the given operator
+// supported operators: > < >= <= == !=
+func compareValues(v1 string, operator string, v2 string) (bool, error) {
+	floatV1, err1 := strconv.ParseFloat(v1, 64)
+	floatV2, err2 := strconv.ParseFloat(v2, 64)
+
+	floatOperators := []string{"<", ">", "<=", ">="}
+	if slices.Contains(floatOperators, operator) && (err1 != nil || err2 != nil) {
+		return false, fmt.Errorf("failed to parse the values (%v and %v) to a float: %v and %v", v1, v2, err1, err2)
+	}
+
+	switch operator {
+	case "<":
+		return floatV1 < floatV2, nil
+	case ">":
+		return floatV1 > floatV2, nil
+	case ">=":
+		return floatV1 >= floatV2, nil
+	case "<=":
+		return floatV1 <= floatV2, nil
+	case "==":
+		return v1 == v2, nil
+	case "!=":
+		return v1 != v2, nil
+	}
+
+	return false, fmt.Errorf("the operator %v is not supported", operator)
+}
+
+// Resolve a boolean expression using the same engine as ~if
+// pattern: <value1> <operator> <value2> [&& <value1> <operator> <value2>] [|| ...]
+// both sides of a comparison can be a function (e.g. ~min $2 $1 < 1000)
+func resolveCondition(configValues []string, bedValues []string, bedHeader []string) (bool, error) {
+	for _, orGroup := range splitTokens(configValues, "||") {
+		result := true
+		for _, comparison := range splitTokens(orGroup, "&&") {
+			operatorIndex := slices.IndexFunc(comparison, func(token string) bool {
+				return slices.Contains(conditionOperators, token)
+			})
+			if operatorIndex < 1 || operatorIndex == len(comparison)-1 {
+				return false, fmt.Errorf("the condition (%v) should look like '<value1> <operator> <value2>'", strings.Join(comparison, " "))
 			}
-		case "<=":
-			if floatV1 <= floatV2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
+
+			v1, err := resolveField(comparison[:operatorIndex], bedValues, bedHeader)
+			if err != nil {
+				return false, err
 			}
-		case "==":
-			if v1 == v2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
+			v2, err := resolveField(comparison[operatorIndex+1:], bedValues, bedHeader)
+			if err != nil {
+				return false, err
 			}
-		case "!=":
-			if v1 != v2 {
-				return vTrue, nil
-			} else {
-				return vFalseResolved, nil
+
+			comparisonResult, err := compareValues(v1, comparison[operatorIndex], v2)
+			if err != nil {
+				return false, err
 			}
+			result = result && comparisonResult
+		}
+		if result {
+			return true, nil
 		}
 	}
+	return false, nil
+}
 
-	err := fmt.Errorf("the function %v is not supported", function)
-	return "", err
+// The operators that can be used in conditions
+var conditionOperators = []string{"<", ">", "<=", ">=", "==", "!="}
+
+// Split the tokens of an expression on the given separator token
+func splitTokens(tokens []string, separator string) [][]string {
+	groups := [][]string{{}}
+	for _, token := range tokens {
+		if token == separator {
+			groups = append(groups, []string{})
+			continue
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], token)
+	}
+	return groups
 }
@@ -171,3 +171,55 @@ func TestIf(t *testing.T) {
 		t.Fatalf("Expected value to be 'true', got %s", value)
 	}
 }
+
+func TestResolveErrors(t *testing.T) {
+	_, err := resolveField([]string{"~min", "10", "NA"}, []string{}, []string{})
+	if err == nil {
+		t.Fatalf("Expected an error when subtracting a non-numeric value, got nil")
+	}
+
+	_, err = resolveField([]string{"~round"}, []string{}, []string{})
+	if err == nil {
+		t.Fatalf("Expected an error when ~round has no arguments, got nil")
+	}
+
+	_, err = resolveField([]string{"~if", "1", "<"}, []string{}, []string{})
+	if err == nil {
+		t.Fatalf("Expected an error when ~if has too few arguments, got nil")
+	}
+
+	_, err = resolveField([]string{"~if", "1", "=~", "2", "true", "false"}, []string{}, []string{})
+	if err == nil {
+		t.Fatalf("Expected an error for an unsupported operator, got nil")
+	}
+}
+
+func TestCondition(t *testing.T) {
+	header := []string{"0", "1", "2", "3"}
+	values := []string{"chr1", "100", "600", "2"}
+
+	result, _ := resolveCondition([]string{"$3", "==", "2"}, values, header)
+	if !result {
+		t.Fatalf("Expected '$3 == 2' to be true")
+	}
+
+	result, _ = resolveCondition([]string{"~min", "$2", "$1", "<", "1000"}, values, header)
+	if !result {
+		t.Fatalf("Expected '~min $2 $1 < 1000' to be true")
+	}
+
+	result, _ = resolveCondition([]string{"$3", "==", "2", "&&", "$0", "!=", "chr1"}, values, header)
+	if result {
+		t.Fatalf("Expected '$3 == 2 && $0 != chr1' to be false")
+	}
+
+	result, _ = resolveCondition([]string{"$3", "==", "3", "||", "$0", "==", "chr1"}, values, header)
+	if !result {
+		t.Fatalf("Expected '$3 == 3 || $0 == chr1' to be true")
+	}
+
+	_, err := resolveCondition([]string{"$3", "2"}, values, header)
+	if err == nil {
+		t.Fatalf("Expected an error for a condition without an operator")
+	}
+}
@@ -0,0 +1,240 @@
+package bedgovcf
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The struct that sorts variants by contig order and position
+// Variants are kept in memory until the memory limit is reached, after which they are sorted and written to temporary files
+type VariantSorter struct {
+	ContigOrder map[string]int // The index of each contig in the header
+	Groups      *VariantGroups // The groups of the records with --split-by, the records are sorted by group first
+	MemoryLimit int64          // The amount of bytes that can be used by the variants in memory
+	TmpDir      string         // The directory to write the temporary files to
+	Chunks      []string       // The temporary files containing sorted chunks of variants
+	buffer      []Variant      // The variants that are currently in memory
+	bufferSize  int64          // The estimated amount of bytes used by the variants in memory
+}
+
+// Create a variant sorter using the contig order of the header
+func newVariantSorter(header Header, memoryLimit int64, tmpDir string) *VariantSorter {
+	order := map[string]int{}
+	for _, v := range header.HeaderLines {
+		if strings.ToLower(v.Category) == "contig" {
+			if _, ok := order[v.id()]; !ok {
+				order[v.id()] = len(order)
+			}
+		}
+	}
+	return &VariantSorter{
+		ContigOrder: order,
+		MemoryLimit: memoryLimit,
+		TmpDir:      tmpDir,
+	}
+}
+
+// Compare two variants by contig order and position
+// Contigs that are not present in the header are sorted after the known contigs by name
+func (vs *VariantSorter) compare(a Variant, b Variant) int {
+	indexA, okA := vs.ContigOrder[a.Chrom]
+	indexB, okB := vs.ContigOrder[b.Chrom]
+	switch {
+	case okA && okB && indexA != indexB:
+		return cmp.Compare(indexA, indexB)
+	case okA && !okB:
+		return -1
+	case !okA && okB:
+		return 1
+	case !okA && !okB && a.Chrom != b.Chrom:
+		return cmp.Compare(a.Chrom, b.Chrom)
+	}
+
+	posA, errA := strconv.ParseInt(a.Pos, 10, 64)
+	posB, errB := strconv.ParseInt(b.Pos, 10, 64)
+	if errA != nil || errB != nil {
+		return cmp.Compare(a.Pos, b.Pos)
+	}
+	return cmp.Compare(posA, posB)
+}
+
+// Compare two variants by group and then by contig order and position
+func (vs *VariantSorter) order(a Variant, b Variant) int {
+	if group := vs.Groups.compare(a, b); group != 0 {
+		return group
+	}
+	return vs.compare(a, b)
+}
+
+// Add a variant to the sorter, the variants in memory are written to a temporary file when the memory limit is reached
+func (vs *VariantSorter) add(variant Variant) error {
+	vs.buffer = append(vs.buffer, variant)
+	vs.bufferSize += variantSize(variant)
+	if vs.MemoryLimit > 0 && vs.bufferSize >= vs.MemoryLimit {
+		return vs.spill()
+	}
+	return nil
+}
+
+// Estimate the amount of bytes used by a variant
+func variantSize(variant Variant) int64 {
+	size := 200 + len(variant.Chrom) + len(variant.Pos) + len(variant.Id) + len(variant.Ref) + len(variant.Alt) + len(variant.Qual) + len(variant.Filter)
+	for _, v := range append(slices.Clone(variant.Info), variant.Format...) {
+		size += 80 + len(v.Name) + len(v.Number) + len(v.Type) + len(v.Value)
+	}
+	return int64(size)
+}
+
+// Sort the variants in memory and write them to a temporary file
+func (vs *VariantSorter) spill() error {
+	slices.SortStableFunc(vs.buffer, vs.order)
+
+	file, err := os.CreateTemp(vs.TmpDir, "bedgovcf-sort-*.gob")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary file for sorting: %v", err)
+	}
+	// The chunk is registered right away so cleanup also removes it when writing fails
+	vs.Chunks = append(vs.Chunks, file.Name())
+
+	encoder := gob.NewEncoder(file)
+	for _, v := range vs.buffer {
+		if err := encoder.Encode(v); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write to the temporary file %v: %v", file.Name(), err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close the temporary file %v: %v", file.Name(), err)
+	}
+
+	vs.buffer = nil
+	vs.bufferSize = 0
+	return nil
+}
+
+// Sort the variants in memory, returns all variants when no temporary files were written
+func (vs *VariantSorter) sorted() ([]Variant, bool) {
+	slices.SortStableFunc(vs.buffer, vs.order)
+	if len(vs.Chunks) != 0 {
+		return nil, false
+	}
+	return vs.buffer, true
+}
+
+// Call the callback for every variant in sorted order by merging the temporary files and the variants in memory
+func (vs *VariantSorter) each(callback func(variant Variant) error) error {
+	slices.SortStableFunc(vs.buffer, vs.order)
+
+	sources := &chunkHeap{compare: vs.order}
+	for i, chunk := range vs.Chunks {
+		file, err := os.Open(chunk)
+		if err != nil {
+			return fmt.Errorf("failed to open the temporary file %v: %v", chunk, err)
+		}
+		defer file.Close()
+
+		decoder := gob.NewDecoder(file)
+		source := &chunkSource{index: i, next: func() (Variant, error) {
+			var variant Variant
+			err := decoder.Decode(&variant)
+			return variant, err
+		}}
+		if err := source.advance(); err != nil {
+			return err
+		}
+		if !source.done {
+			heap.Push(sources, source)
+		}
+	}
+
+	bufferIndex := 0
+	memory := &chunkSource{index: len(vs.Chunks), next: func() (Variant, error) {
+		if bufferIndex == len(vs.buffer) {
+			return Variant{}, io.EOF
+		}
+		bufferIndex++
+		return vs.buffer[bufferIndex-1], nil
+	}}
+	if err := memory.advance(); err != nil {
+		return err
+	}
+	if !memory.done {
+		heap.Push(sources, memory)
+	}
+
+	for sources.Len() != 0 {
+		source := (*sources).sources[0]
+		if err := callback(source.current); err != nil {
+			return err
+		}
+		if err := source.advance(); err != nil {
+			return err
+		}
+		if source.done {
+			heap.Pop(sources)
+		} else {
+			heap.Fix(sources, 0)
+		}
+	}
+	return nil
+}
+
+// Remove the temporary files
+func (vs *VariantSorter) cleanup() {
+	for _, chunk := range vs.Chunks {
+		os.Remove(chunk)
+	}
+	vs.Chunks = nil
+	vs.buffer = nil
+}
+
+// One sorted source of variants used while merging
+type chunkSource struct {
+	index   int                     // The index of the source, used to keep the sort stable
+	current Variant                 // The current variant of the source
+	done    bool                    // Whether all variants of the source have been read
+	next    func() (Variant, error) // Read the next variant of the source
+}
+
+// Read the next variant of the source
+func (cs *chunkSource) advance() error {
+	variant, err := cs.next()
+	if errors.Is(err, io.EOF) {
+		cs.done = true
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read a temporary file for sorting: %v", err)
+	}
+	cs.current = variant
+	return nil
+}
+
+// A heap of sources ordered by their current variant
+type chunkHeap struct {
+	sources []*chunkSource
+	compare func(a Variant, b Variant) int
+}
+
+func (ch chunkHeap) Len() int { return len(ch.sources) }
+func (ch chunkHeap) Less(i, j int) bool {
+	result := ch.compare(ch.sources[i].current, ch.sources[j].current)
+	if result == 0 {
+		return ch.sources[i].index < ch.sources[j].index
+	}
+	return result < 0
+}
+func (ch chunkHeap) Swap(i, j int)    { ch.sources[i], ch.sources[j] = ch.sources[j], ch.sources[i] }
+func (ch *chunkHeap) Push(source any) { ch.sources = append(ch.sources, source.(*chunkSource)) }
+func (ch *chunkHeap) Pop() any {
+	source := ch.sources[len(ch.sources)-1]
+	ch.sources = ch.sources[:len(ch.sources)-1]
+	return source
+}
@@ -0,0 +1,82 @@
+package bedgovcf
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestSortVariants(t *testing.T) {
+	header := Header{}
+	addTestContigs(t, &header)
+
+	variants := []Variant{
+		{Chrom: "chr2", Pos: "5", Id: "a"},
+		{Chrom: "chr10", Pos: "1", Id: "b"},
+		{Chrom: "chr1", Pos: "100", Id: "c"},
+		{Chrom: "chr1", Pos: "20", Id: "d"},
+		{Chrom: "chr2", Pos: "5", Id: "e"},
+		{Chrom: "chr1", Pos: "3", Id: "f"},
+	}
+	expected := []string{"f", "d", "c", "a", "e", "b"}
+
+	for _, memoryLimit := range []int64{0, 1} {
+		tmpDir := t.TempDir()
+		sorter := newVariantSorter(header, memoryLimit, tmpDir)
+		for _, v := range variants {
+			if err := sorter.add(v); err != nil {
+				t.Fatalf("Failed to add a variant to the sorter: %v", err)
+			}
+		}
+
+		ids := []string{}
+		err := sorter.each(func(variant Variant) error {
+			ids = append(ids, variant.Id)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to merge the sorted variants: %v", err)
+		}
+		sorter.cleanup()
+
+		if len(ids) != len(expected) {
+			t.Fatalf("Expected %d variants, got %d", len(expected), len(ids))
+		}
+		for i := range expected {
+			if ids[i] != expected[i] {
+				t.Fatalf("Expected the variants to be sorted as %v, got %v (memory limit %d)", expected, ids, memoryLimit)
+			}
+		}
+
+		files, _ := os.ReadDir(tmpDir)
+		if len(files) != 0 {
+			t.Fatalf("Expected the temporary files to be removed, found %d", len(files))
+		}
+	}
+}
+
+func TestSortCleanupOnWriteError(t *testing.T) {
+	header := Header{}
+	addTestContigs(t, &header)
+	tmpDir := t.TempDir()
+	sorter := newVariantSorter(header, 1, tmpDir)
+	for _, v := range []Variant{{Chrom: "chr2", Pos: "5"}, {Chrom: "chr1", Pos: "3"}} {
+		if err := sorter.add(v); err != nil {
+			t.Fatalf("Failed to add a variant to the sorter: %v", err)
+		}
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("output-format", "vcf3", "")
+	vcf := Vcf{Header: header, sorter: sorter}
+	if err := vcf.Write(cli.NewContext(&cli.App{}, set, nil)); err == nil {
+		t.Fatalf("Expected an error for an unsupported output format, got none")
+	}
+
+	files, _ := os.ReadDir(tmpDir)
+	if len(files) != 0 {
+		t.Fatalf("Expected the temporary files to be removed after a failed write, found %d", len(files))
+	}
+}
@@ -0,0 +1,104 @@
+package bedgovcf
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The characters that are replaced in the group names used in the output paths
+var unsafeGroupCharacters = regexp.MustCompile(`[^0-9A-Za-z_.+-]`)
+
+// The struct that keeps track of the groups of the records when the output is split
+// The records are written one group at a time, so only one output file is open at a time
+type VariantGroups struct {
+	SplitBy string              // The expression used to determine the group (chrom for the chromosome)
+	Names   []string            // The names of the groups in the order they were found
+	Order   map[string]int      // The index of each group in Names
+	Values  map[string]string   // The value each group name was made from (before replacing the unsafe characters)
+	Contigs map[string][]string // The contigs of the records in each group
+}
+
+// Create the groups for the --split-by value, returns nil when the output isn't split
+func newVariantGroups(splitBy string, output string) (*VariantGroups, error) {
+	if splitBy == "" {
+		return nil, nil
+	}
+	if !strings.Contains(output, "{group}") {
+		return nil, errors.New("--split-by needs an output path with a {group} placeholder (e.g. --output out/{group}.vcf.gz)")
+	}
+	return &VariantGroups{
+		SplitBy: splitBy,
+		Order:   map[string]int{},
+		Values:  map[string]string{},
+		Contigs: map[string][]string{},
+	}, nil
+}
+
+// Determine the group of a variant from the BED line
+func (vg *VariantGroups) group(variant Variant, line []string, header []string) (string, error) {
+	group := variant.Chrom
+	if strings.ToLower(vg.SplitBy) != "chrom" {
+		var err error
+		group, err = resolveField(strings.Split(vg.SplitBy, " "), line, header)
+		if err != nil {
+			return "", &ConversionError{Field: "split-by", Expression: vg.SplitBy, Err: err}
+		}
+	}
+	if isMissing(group) {
+		return "", &ConversionError{Field: "split-by", Expression: vg.SplitBy, Err: errors.New("the group of the row is empty")}
+	}
+	return group, nil
+}
+
+// Assign a group to a variant and add the contig of the variant to the group
+// Returns an error when two groups have the same name after replacing the unsafe characters, they would write to the same file
+func (vg *VariantGroups) assign(variant *Variant, group string) error {
+	variant.Group = unsafeGroupCharacters.ReplaceAllString(group, "_")
+	value, ok := vg.Values[variant.Group]
+	if !ok {
+		vg.Order[variant.Group] = len(vg.Names)
+		vg.Names = append(vg.Names, variant.Group)
+		vg.Values[variant.Group] = group
+	} else if value != group {
+		return fmt.Errorf("the --split-by groups '%v' and '%v' would both be written to %v", value, group, variant.Group)
+	}
+	contigs := vg.Contigs[variant.Group]
+	if !slices.Contains(contigs, variant.Chrom) {
+		vg.Contigs[variant.Group] = append(contigs, variant.Chrom)
+	}
+	return nil
+}
+
+// Compare two variants by the order of their groups, variants are equal when the output isn't split
+func (vg *VariantGroups) compare(a Variant, b Variant) int {
+	if vg == nil {
+		return 0
+	}
+	return cmp.Compare(vg.Order[a.Group], vg.Order[b.Group])
+}
+
+// Get the output path of a group
+func groupPath(output string, group string) string {
+	return strings.ReplaceAll(output, "{group}", group)
+}
+
+// Get the header of a group, the contig header lines are restricted to the contigs of the group when restrict is true
+func (vg *VariantGroups) header(h Header, group string, restrict bool) Header {
+	if !restrict {
+		return h
+	}
+	contigs := vg.Contigs[group]
+	h.HeaderLines = slices.DeleteFunc(slices.Clone(h.HeaderLines), func(line HeaderLine) bool {
+		return strings.ToLower(line.Category) == "contig" && !slices.Contains(contigs, line.id())
+	})
+	return h
+}
+
+// Describe the groups for the log
+func (vg *VariantGroups) String() string {
+	return fmt.Sprintf("Split the records into %v file(s) by %v", len(vg.Names), vg.SplitBy)
+}
@@ -0,0 +1,134 @@
+package bedgovcf
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+func TestVariantGroups(t *testing.T) {
+	if _, err := newVariantGroups("chrom", "out.vcf"); err == nil {
+		t.Fatalf("Expected an error for an output without {group}, got none")
+	}
+	if groups, _ := newVariantGroups("", "out.vcf"); groups != nil {
+		t.Fatalf("Expected no groups without --split-by, got %v", groups)
+	}
+
+	header := []string{"chrom", "start", "end", "panel"}
+	groups, err := newVariantGroups("$panel", "out/{group}.vcf")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows := [][]string{
+		{"chr1", "1", "10", "cardio"},
+		{"chr2", "1", "10", "onco/v2"},
+		{"chr3", "1", "10", "cardio"},
+	}
+	for _, row := range rows {
+		variant := Variant{Chrom: row[0]}
+		group, err := groups.group(variant, row, header)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := groups.assign(&variant, group); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	if len(groups.Names) != 2 || groups.Names[0] != "cardio" || groups.Names[1] != "onco_v2" {
+		t.Fatalf("Expected the groups cardio and onco_v2, got %v", groups.Names)
+	}
+	if path := groupPath("out/{group}.vcf", "onco_v2"); path != "out/onco_v2.vcf" {
+		t.Fatalf("Expected out/onco_v2.vcf, got %v", path)
+	}
+
+	vcfHeader := Header{HeaderLines: []HeaderLine{
+		newHeaderLine("contig", "ID", "chr1", "length", "100"),
+		newHeaderLine("contig", "ID", "chr2", "length", "100"),
+		newHeaderLine("contig", "ID", "chr3", "length", "100"),
+		newHeaderLine("INFO", "ID", "END"),
+	}}
+	restricted := groups.header(vcfHeader, "cardio", true)
+	if len(restricted.HeaderLines) != 3 || restricted.HeaderLines[1].id() != "chr3" {
+		t.Fatalf("Expected the contigs chr1 and chr3 and the INFO line, got %v", restricted.HeaderLines)
+	}
+	if len(vcfHeader.HeaderLines) != 4 {
+		t.Fatalf("Expected the original header to be unchanged, got %v", vcfHeader.HeaderLines)
+	}
+	if unrestricted := groups.header(vcfHeader, "cardio", false); len(unrestricted.HeaderLines) != 4 {
+		t.Fatalf("Expected all header lines without restriction, got %v", unrestricted.HeaderLines)
+	}
+
+	variant := Variant{Chrom: "chr1"}
+	if _, err := groups.group(variant, []string{"chr1", "1", "10", "."}, header); err == nil {
+		t.Fatalf("Expected an error for an empty group, got none")
+	}
+
+	// onco:v2 and onco/v2 would both be written to out/onco_v2.vcf
+	if err := groups.assign(&variant, "onco:v2"); err == nil {
+		t.Fatalf("Expected an error for groups with the same name, got none")
+	}
+	if err := groups.assign(&variant, "onco/v2"); err != nil {
+		t.Fatalf("Expected no error for a known group, got %v", err)
+	}
+}
+
+func TestSplitWrite(t *testing.T) {
+	header := Header{Version: "4.2", SitesOnly: true}
+	addTestContigs(t, &header)
+
+	write := func(dir string, variants []Variant) error {
+		groups, err := newVariantGroups("chrom", filepath.Join(dir, "{group}.vcf"))
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for i := range variants {
+			if err := groups.assign(&variants[i], variants[i].Chrom); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+		slices.SortStableFunc(variants, groups.compare)
+
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		set.String("output", filepath.Join(dir, "{group}.vcf"), "")
+		set.Bool("validate", true, "")
+		vcf := Vcf{Header: header, Variants: variants, groups: groups}
+		return vcf.Write(cli.NewContext(&cli.App{}, set, nil))
+	}
+	variant := func(chrom string, pos string, filter string) Variant {
+		return Variant{Chrom: chrom, Pos: pos, Id: ".", Ref: "N", Alt: "<DEL>", Qual: ".", Filter: filter}
+	}
+
+	dir := t.TempDir()
+	if err := write(dir, []Variant{variant("chr1", "1", "PASS"), variant("chr2", "2", "PASS"), variant("chr1", "3", "PASS")}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for file, expected := range map[string][]string{"chr1.vcf": {"1", "3"}, "chr2.vcf": {"2"}} {
+		content, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatalf("Expected the output %v, got %v", file, err)
+		}
+		positions := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			if !strings.HasPrefix(line, "#") {
+				positions = append(positions, strings.Split(line, "\t")[1])
+			}
+		}
+		if !slices.Equal(positions, expected) {
+			t.Fatalf("Expected the positions %v in %v, got %v", expected, file, positions)
+		}
+	}
+
+	// No output is moved to its path when a later group fails
+	dir = t.TempDir()
+	if err := write(dir, []Variant{variant("chr1", "1", "PASS"), variant("chr2", "2", "FOO")}); err == nil {
+		t.Fatalf("Expected an error for an undeclared filter, got none")
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("Expected no files after a failed split, got %v", files)
+	}
+}
@@ -6,42 +6,64 @@ package bedgovcf
 
 // The main config struct
 type Config struct {
-	Header []ConfigHeaderStruct        // Additional headers to add to the VCF
-	Chrom  ConfigStandardFieldStruct   // The chromosome field
-	Pos    ConfigStandardFieldStruct   // The position field
-	Id     ConfigStandardFieldStruct   // The ID field
-	Ref    ConfigStandardFieldStruct   // The reference field
-	Alt    ConfigStandardFieldStruct   // The alt field
-	Qual   ConfigStandardFieldStruct   // The quality field
-	Filter ConfigStandardFieldStruct   // The filter field
-	Info   SliceConfigInfoFormatStruct // The info fields
-	Format SliceConfigInfoFormatStruct // The format fields
+	Version  string                      // The VCF version to write (4.2, 4.3 or 4.4)
+	Header   []ConfigHeaderStruct        // Additional headers to add to the VCF
+	Include  string                      // Only convert the rows for which this condition is true
+	Exclude  string                      // Don't convert the rows for which this condition is true
+	Assembly string                      // The assembly to add to the contig header lines
+	Species  string                      // The species to add to the contig header lines
+	Rounding string                      // How floats are converted for Integer fields (round, truncate or error)
+	Chrom    ConfigStandardFieldStruct   // The chromosome field
+	Pos      ConfigStandardFieldStruct   // The position field
+	Id       ConfigStandardFieldStruct   // The ID field
+	Ref      ConfigStandardFieldStruct   // The reference field
+	Alt      ConfigStandardFieldStruct   // The alt field
+	Qual     ConfigStandardFieldStruct   // The quality field
+	Filter   ConfigStandardFieldStruct   // The filter field
+	Info     SliceConfigInfoFormatStruct // The info fields
+	Format   SliceConfigInfoFormatStruct // The format fields
 }
 
 // The struct for the additional headers
 type ConfigHeaderStruct struct {
-	Name        string // The name of the header line
-	Content     string // The content of the header line
-	Description string // The description of the header line
+	Name        string           // The name of the header line
+	Content     string           // The content of the header line
+	Description string           // The description of the header line
+	Attributes  ConfigAttributes // The attributes of a structured header line (only for the additional headers)
 }
 
+// The attributes of a structured header line in the order of the config
+type ConfigAttributes []HeaderAttribute
+
 // The struct for the standard fields
 type ConfigStandardFieldStruct struct {
-	Value   string               // The value to use
-	Prefix  string               // The prefix to add to each value
-	Options []ConfigHeaderStruct // The different options possible (only for ALT and FILTER)
+	Value    string                   // The value to use
+	Prefix   string                   // The prefix to add to each value
+	Template string                   // The template used to compose the value (only for ID)
+	Counter  *bool                    // Whether the record count is appended to the value (only for ID)
+	Options  []ConfigHeaderStruct     // The different options possible (only for ALT and FILTER)
+	Rules    []ConfigFilterRuleStruct // The rules used to compose the value (only for FILTER)
+}
+
+// The struct for the filter rules
+type ConfigFilterRuleStruct struct {
+	Name        string // The ID of the filter
+	Description string // The description of the filter
+	Condition   string // The condition for which the filter applies
 }
 
 type SliceConfigInfoFormatStruct []ConfigInfoFormatStruct
 
 // The struct for the info and format fields
 type ConfigInfoFormatStruct struct {
-	Name        string // The name of the current INFO or FORMAT field
-	Value       string // The value to use
-	Prefix      string // The prefix to add to each value
-	Description string // The description of the field
-	Number      string // The number of values that can be included in the INFO field (e.g. 1, 2, A, R)
-	Type        string // The type of the header field (e.g. Integer, Float, Character, Flag)
+	Name        string           // The name of the current INFO or FORMAT field
+	Value       string           // The value to use
+	Prefix      string           // The prefix to add to each value
+	Description string           // The description of the field
+	Number      string           // The number of values that can be included in the INFO field (e.g. 1, 2, A, R)
+	Type        string           // The type of the header field (e.g. Integer, Float, Character, Flag)
+	When        string           // The condition for which the field is added
+	Attributes  ConfigAttributes // Additional attributes of the header line (e.g. Source and Version)
 }
 
 //
@@ -50,8 +72,13 @@ type ConfigInfoFormatStruct struct {
 
 // The main VCF struct
 type Vcf struct {
-	Header   Header    // The header of the VCF
-	Variants []Variant // The variants of the VCF
+	Header        Header         // The header of the VCF
+	Variants      []Variant      // The variants of the VCF
+	chromMapper   *ChromMapper   // Translates the chromosome names (nil when no translation is needed)
+	assemblyCheck *AssemblyCheck // Checks if the data fits the assembly of the contigs
+	sorter        *VariantSorter // Holds the sorted variants that didn't fit in memory (nil when all variants are in Variants)
+	groups        *VariantGroups // The groups of the records when the output is split (nil when the output isn't split)
+	ids           *IdGenerator   // Assigns the final IDs of the records (nil when the default ID settings are used)
 }
 
 // The struct for the header
@@ -59,17 +86,21 @@ type Header struct {
 	HeaderLines []HeaderLine // All conventional header lines
 	Version     string       // The version of the VCF file
 	Sample      string       // The sample name
+	SitesOnly   bool         // Whether the FORMAT and sample columns are left out
 }
 
 // The struct for one header line
 type HeaderLine struct {
-	Category    string // The category of header line (e.g INFO, FORMAT, FILTER)
-	Id          string // The ID of the header line (e.g. SVLEN, GT, END)
-	Number      string // The number of values that can be included in the INFO field (e.g. 1, 2, A, R)
-	Type        string // The type of the header field (e.g. Integer, Float, Character, Flag)
-	Description string // The description of the header line
-	Length      string // The length of the contig (only for contig header lines)
-	Content     string // The content of the header line (only for non usual header lines)
+	Category   string            // The category of header line (e.g INFO, FORMAT, FILTER)
+	Attributes []HeaderAttribute // The attributes of a structured header line in their order (e.g. ID, Number, Type, Description)
+	Content    string            // The content of the header line (only for unstructured header lines, e.g. ##source=bedgovcf)
+	Verbatim   bool              // Whether the line is written as it was read (only for the lines of a header template)
+}
+
+// The struct for one attribute of a structured header line
+type HeaderAttribute struct {
+	Key   string // The key of the attribute (e.g. ID, Number, length)
+	Value string // The unescaped value of the attribute
 }
 
 // The struct for one variant
@@ -83,6 +114,7 @@ type Variant struct {
 	Filter string                 // The filter
 	Info   SliceVariantInfoFormat // The info fields
 	Format SliceVariantInfoFormat // The format fields
+	Group  string                 // The output file group of the variant (only used with --split-by)
 }
 
 // The map for the info and format fields
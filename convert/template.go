@@ -0,0 +1,94 @@
+package bedgovcf
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The unstructured header lines that are only written once, the generated line replaces the line of the template
+var singleHeaderLines = []string{"fileDate", "source", "reference"}
+
+// Read the meta lines of a (gzipped) VCF file that is used as header template
+// The lines are written as they were read, without uppercasing their IDs
+func readHeaderTemplate(path string) ([]HeaderLine, error) {
+	reader, err := openVcf(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the header template: %v", err)
+	}
+	defer reader.Close()
+	lines := reader.Header.HeaderLines
+	for i := range lines {
+		lines[i].Verbatim = true
+	}
+	return lines, nil
+}
+
+// Merge the lines of a header template into the header, the lines of the template are written first
+// Lines that are also generated are only written once (the generated line is kept), see generatedLineIndex for how the IDs are compared
+// Contig lines and the provenance lines of bedgovcf (e.g. ##bedgovcfConfig) are left out, they describe the template and not this conversion
+// Returns the INFO and FORMAT fields that have a different Number or Type in the template and the fields that are written in another case
+func (h *Header) mergeTemplate(template []HeaderLine) []string {
+	conflicts := []string{}
+	merged := Header{}
+	for _, line := range template {
+		category := strings.ToLower(line.Category)
+		if category == "contig" || strings.HasPrefix(line.Category, "bedgovcf") {
+			continue
+		}
+
+		if len(line.Attributes) == 0 {
+			if !h.hasUnstructuredLine(line) && !merged.hasUnstructuredLine(line) {
+				merged.addLine(line)
+			}
+			continue
+		}
+
+		if merged.writtenLineIndex(line) != -1 {
+			continue
+		}
+		index := h.generatedLineIndex(line)
+		if index == -1 {
+			merged.addLine(line)
+			continue
+		}
+
+		generated := &h.HeaderLines[index]
+		if line.writtenId() != generated.writtenId() {
+			conflict := fmt.Sprintf("%v/%v of the header template is written as %v like in the records", strings.ToUpper(line.Category), line.writtenId(), generated.writtenId())
+			if !slices.Contains(conflicts, conflict) {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+		if (category == "info" || category == "format") && (generated.get("Number") != line.get("Number") || !strings.EqualFold(generated.get("Type"), line.get("Type"))) {
+			conflicts = append(conflicts, fmt.Sprintf("%v/%v is defined with Number=%v and Type=%v in the config, but with Number=%v and Type=%v in the header template", strings.ToUpper(line.Category), generated.writtenId(), generated.get("Number"), generated.get("Type"), line.get("Number"), line.get("Type")))
+		}
+		if generated.get("Description") == "" && line.get("Description") != "" {
+			generated.set("Description", line.get("Description"))
+		}
+	}
+	h.HeaderLines = append(merged.HeaderLines, h.HeaderLines...)
+	return conflicts
+}
+
+// Get the index of the header line with the same category and written ID, returns -1 when the line isn't present
+func (h *Header) writtenLineIndex(line HeaderLine) int {
+	return slices.IndexFunc(h.HeaderLines, func(v HeaderLine) bool {
+		return len(v.Attributes) != 0 && strings.EqualFold(v.Category, line.Category) && v.writtenId() == line.writtenId()
+	})
+}
+
+// Get the index of the generated header line that defines the same field as a line of the template, returns -1 when the line isn't present
+// The template ID is compared as it would be written by a generated line, so INFO, FORMAT, ALT and FILTER IDs that only differ in case are the same field
+func (h *Header) generatedLineIndex(line HeaderLine) int {
+	line.Verbatim = false
+	return h.writtenLineIndex(line)
+}
+
+// Check if the header already has an unstructured line with the same category and content
+// Only one line is kept for the categories that can only occur once (e.g. fileDate)
+func (h *Header) hasUnstructuredLine(line HeaderLine) bool {
+	return slices.ContainsFunc(h.HeaderLines, func(v HeaderLine) bool {
+		return len(v.Attributes) == 0 && v.Category == line.Category && (v.Content == line.Content || slices.Contains(singleHeaderLines, line.Category))
+	})
+}
@@ -0,0 +1,102 @@
+package bedgovcf
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadHeaderTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "template.vcf.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	writer := gzip.NewWriter(file)
+	writer.Write([]byte("##fileformat=VCFv4.2\n##cohort=test\n##FILTER=<ID=LowQual,Description=\"Low quality\">\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"))
+	writer.Close()
+	file.Close()
+
+	lines, err := readHeaderTemplate(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := []HeaderLine{
+		{Category: "cohort", Content: "test", Verbatim: true},
+		verbatim(newHeaderLine("FILTER", "ID", "LowQual", "Description", "Low quality")),
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("Expected %v, got %v", expected, lines)
+	}
+	// The lines of the template are written as they were read
+	if line := lines[1].String(); line != `##FILTER=<ID=LowQual,Description="Low quality">` {
+		t.Fatalf("Expected the FILTER line to be written as it was read, got %v", line)
+	}
+
+	if _, err := readHeaderTemplate(filepath.Join(dir, "missing.vcf")); err == nil {
+		t.Fatalf("Expected an error for a missing header template, got none")
+	}
+}
+
+// Mark a header line as read from a header template
+func verbatim(line HeaderLine) HeaderLine {
+	line.Verbatim = true
+	return line
+}
+
+func TestMergeTemplate(t *testing.T) {
+	header := Header{}
+	header.addLine(HeaderLine{Category: "fileDate", Content: "20240101"})
+	header.addLine(newHeaderLine("INFO", "ID", "SVLEN", "Number", "1", "Type", "Integer", "Description", "Length"))
+	header.addLine(newHeaderLine("INFO", "ID", "svtype", "Number", "1", "Type", "String", "Description", ""))
+	header.addLine(newHeaderLine("FILTER", "ID", "LowQual", "Description", "Quality below 20"))
+	header.addLine(newHeaderLine("contig", "ID", "chr1", "length", "100"))
+
+	template := []HeaderLine{
+		{Category: "fileDate", Content: "20200101", Verbatim: true},
+		{Category: "cohort", Content: "test", Verbatim: true},
+		{Category: "cohort", Content: "test", Verbatim: true},
+		{Category: "bedgovcfCommand", Content: "bedgovcf --bed old.bed", Verbatim: true},
+		{Category: "bedgovcfConfig", Content: "e30K", Verbatim: true},
+		verbatim(newHeaderLine("bedgovcfInput", "ID", "bed", "File", "old.bed", "SHA256", "0")),
+		verbatim(newHeaderLine("INFO", "ID", "SVLEN", "Number", ".", "Type", "Integer", "Description", "Template length")),
+		verbatim(newHeaderLine("INFO", "ID", "SVTYPE", "Number", "1", "Type", "string", "Description", "Type of the variant")),
+		verbatim(newHeaderLine("INFO", "ID", "svlen", "Number", "1", "Type", "Integer", "Description", "Lowercase length")),
+		verbatim(newHeaderLine("FILTER", "ID", "LowQual", "Description", "Low quality")),
+		verbatim(newHeaderLine("FILTER", "ID", "LowQual", "Description", "Other")),
+		verbatim(newHeaderLine("FILTER", "ID", "lowqual", "Description", "Lowercase")),
+		verbatim(newHeaderLine("FILTER", "ID", "Rejected", "Description", "Rejected")),
+		verbatim(newHeaderLine("FILTER", "ID", "rejected", "Description", "Lowercase")),
+		verbatim(newHeaderLine("contig", "ID", "chr2", "length", "200")),
+	}
+
+	// The generated lines are written in uppercase (svtype as SVTYPE), template IDs that only differ in case define the same field
+	conflicts := header.mergeTemplate(template)
+	expectedConflicts := []string{
+		"INFO/SVLEN is defined with Number=1 and Type=Integer in the config, but with Number=. and Type=Integer in the header template",
+		"INFO/svlen of the header template is written as SVLEN like in the records",
+		"FILTER/LowQual of the header template is written as LOWQUAL like in the records",
+		"FILTER/lowqual of the header template is written as LOWQUAL like in the records",
+	}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Fatalf("Expected the conflicts %v, got %v", expectedConflicts, conflicts)
+	}
+
+	// Template lines that aren't generated are kept as they are
+	expected := []HeaderLine{
+		{Category: "cohort", Content: "test", Verbatim: true},
+		verbatim(newHeaderLine("FILTER", "ID", "Rejected", "Description", "Rejected")),
+		verbatim(newHeaderLine("FILTER", "ID", "rejected", "Description", "Lowercase")),
+		{Category: "fileDate", Content: "20240101"},
+		newHeaderLine("INFO", "ID", "SVLEN", "Number", "1", "Type", "Integer", "Description", "Length"),
+		newHeaderLine("INFO", "ID", "svtype", "Number", "1", "Type", "String", "Description", "Type of the variant"),
+		newHeaderLine("FILTER", "ID", "LowQual", "Description", "Quality below 20"),
+		newHeaderLine("contig", "ID", "chr1", "length", "100"),
+	}
+	if !reflect.DeepEqual(header.HeaderLines, expected) {
+		t.Fatalf("Expected %v, got %v", expected, header.HeaderLines)
+	}
+}
@@ -0,0 +1,284 @@
+package bedgovcf
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+// The structural variant types that can be used as symbolic alleles without an ALT header line
+var reservedAlts = []string{"DEL", "INS", "DUP", "INV", "CNV", "BND"}
+
+// The struct that checks the records of a VCF against its header
+// The IDs are matched case-sensitively, the same as other VCF tools do
+type VcfValidator struct {
+	File      string                // The file the records are written to or read from (only used in the problems)
+	Converted bool                  // The records are validated before they are written (with --validate)
+	Info      map[string]HeaderLine // The INFO header lines by ID
+	Format    map[string]HeaderLine // The FORMAT header lines by ID
+	Filters   map[string]bool       // The IDs of the FILTER header lines
+	Alts      map[string]bool       // The IDs of the ALT header lines
+	Ids       map[string]int        // The line of the first record with each ID
+}
+
+// Create a validator for the records of a header, returns the problems of the header lines themselves
+// Converted records are checked the way they are written: the header IDs and the INFO and FORMAT names are written
+// in uppercase and Flag fields have the value true
+func (h *Header) newVcfValidator(file string, converted bool) (*VcfValidator, []error) {
+	validator := &VcfValidator{
+		File:      file,
+		Converted: converted,
+		Info:      map[string]HeaderLine{},
+		Format:    map[string]HeaderLine{},
+		Filters:   map[string]bool{"PASS": true},
+		Alts:      map[string]bool{},
+		Ids:       map[string]int{},
+	}
+
+	problems := []error{}
+	for _, v := range h.HeaderLines {
+		id := v.id()
+		if converted {
+			id = v.writtenId()
+		}
+		switch strings.ToLower(v.Category) {
+		case "info", "format":
+			field := fmt.Sprintf("%v/%v", strings.ToUpper(v.Category), id)
+			if err := checkDefinition(v); err != nil {
+				problems = append(problems, &ConversionError{File: file, Field: field, Err: err})
+			}
+			if strings.ToLower(v.Category) == "info" {
+				validator.Info[id] = v
+			} else {
+				validator.Format[id] = v
+			}
+		case "filter":
+			validator.Filters[id] = true
+		case "alt":
+			validator.Alts[id] = true
+		}
+	}
+	return validator, problems
+}
+
+// Check the Number and Type of an INFO or FORMAT header line
+func checkDefinition(line HeaderLine) error {
+	valueType := strings.ToLower(line.get("Type"))
+	number := line.get("Number")
+	if !slices.Contains([]string{"integer", "float", "flag", "character", "string"}, valueType) {
+		return fmt.Errorf("the type (%v) is not valid, use Integer, Float, Flag, Character or String", line.get("Type"))
+	}
+	if valueType == "flag" && (strings.ToLower(line.Category) == "format" || number != "0") {
+		return errors.New("Flag fields are only allowed in INFO and need Number=0")
+	}
+	if _, err := strconv.Atoi(number); err != nil && !slices.Contains([]string{"A", "R", "G", "."}, number) {
+		return fmt.Errorf("the number (%v) is not valid, use an integer, A, R, G or .", number)
+	}
+	return nil
+}
+
+// Check a record against the header, the line is the line of the record in the VCF file
+func (vv *VcfValidator) validate(variant Variant, line int) []error {
+	problems := []error{}
+	problem := func(field string, err error) {
+		problems = append(problems, &ConversionError{File: vv.File, Line: line, Field: field, Err: err})
+	}
+
+	if position, err := strconv.ParseInt(variant.Pos, 10, 64); err != nil || position < 0 {
+		problem("POS", fmt.Errorf("the position (%v) is not a positive integer", variant.Pos))
+	}
+
+	if !isMissing(variant.Id) {
+		for _, v := range strings.Split(variant.Id, ";") {
+			if first, ok := vv.Ids[v]; ok {
+				problem("ID", fmt.Errorf("the ID %v is not unique, it was already used on line %v", v, first))
+			} else {
+				vv.Ids[v] = line
+			}
+		}
+	}
+
+	alts := 0
+	if !isMissing(variant.Alt) {
+		for _, alt := range strings.Split(variant.Alt, ",") {
+			alts++
+			if !strings.HasPrefix(alt, "<") || !strings.HasSuffix(alt, ">") {
+				continue
+			}
+			altId := alt[1 : len(alt)-1]
+			if !vv.Alts[altId] && !slices.Contains(reservedAlts, strings.Split(altId, ":")[0]) {
+				problem("ALT", fmt.Errorf("the symbolic allele %v is not declared in the header", alt))
+			}
+		}
+	}
+
+	if !isMissing(variant.Filter) {
+		for _, filter := range strings.Split(variant.Filter, ";") {
+			if !vv.Filters[filter] {
+				problem("FILTER", fmt.Errorf("the filter %v is not declared in the header", filter))
+			}
+		}
+	}
+
+	// The ploidy is used to determine the amount of values of Number=G fields
+	ploidy := 2
+	for _, v := range variant.Format {
+		if vv.name(v) == "GT" && !isMissing(v.Value) {
+			ploidy = len(strings.FieldsFunc(v.Value, func(r rune) bool { return r == '/' || r == '|' }))
+		}
+	}
+
+	for _, v := range variant.Info {
+		if isMissing(v.Value) && v.Value != "" {
+			continue
+		}
+		name := vv.name(v)
+		definition, ok := vv.Info[name]
+		if !ok {
+			problem("INFO/"+name, errors.New("the INFO field is not declared in the header"))
+			continue
+		}
+		if strings.ToLower(definition.get("Type")) == "flag" {
+			// Converted Flag fields have the value true, they are written without it
+			if v.Value != "" && !(vv.Converted && v.Value == "true") {
+				problem("INFO/"+name, fmt.Errorf("Flag fields can't have a value, got %v", v.Value))
+			}
+			continue
+		}
+		if v.Value == "" {
+			problem("INFO/"+name, errors.New("the INFO field has no value"))
+			continue
+		}
+		if err := checkValues(definition, v.Value, alts, ploidy); err != nil {
+			problem("INFO/"+name, err)
+		}
+	}
+
+	for i, v := range variant.Format {
+		name := vv.name(v)
+		if name == "GT" && i != 0 {
+			problem("FORMAT/GT", errors.New("GT has to be the first FORMAT field"))
+		}
+		definition, ok := vv.Format[name]
+		if !ok {
+			problem("FORMAT/"+name, errors.New("the FORMAT field is not declared in the header"))
+			continue
+		}
+		if isMissing(v.Value) {
+			continue
+		}
+		if err := checkValues(definition, v.Value, alts, ploidy); err != nil {
+			problem("FORMAT/"+name, err)
+		}
+	}
+
+	return problems
+}
+
+// The name of an INFO or FORMAT field as it is written
+func (vv *VcfValidator) name(field VariantInfoFormat) string {
+	if vv.Converted {
+		return strings.ToUpper(field.Name)
+	}
+	return field.Name
+}
+
+// Check the values of a field against its Type and Number
+func checkValues(definition HeaderLine, value string, alts int, ploidy int) error {
+	values := strings.Split(value, ",")
+
+	number := definition.get("Number")
+	expected := -1
+	switch number {
+	case "A":
+		expected = alts
+	case "R":
+		expected = alts + 1
+	case "G":
+		// The amount of unordered genotypes with the ploidy of the sample
+		expected = 1
+		for i := 1; i <= ploidy; i++ {
+			expected = expected * (alts + i) / i
+		}
+	case ".":
+	default:
+		expected, _ = strconv.Atoi(number)
+	}
+	// A single missing value is allowed for every Number
+	if expected != -1 && len(values) != expected && value != "." {
+		return fmt.Errorf("expected %v value(s) for Number=%v, got %v (%v)", expected, number, len(values), value)
+	}
+
+	for _, v := range values {
+		if v == "." {
+			continue
+		}
+		switch strings.ToLower(definition.get("Type")) {
+		case "integer":
+			if _, err := strconv.ParseInt(v, 10, 32); err != nil {
+				return fmt.Errorf("the value (%v) is not an Integer", v)
+			}
+		case "float":
+			if _, err := strconv.ParseFloat(v, 32); err != nil {
+				return fmt.Errorf("the value (%v) is not a Float", v)
+			}
+		case "character":
+			if len([]rune(v)) != 1 {
+				return fmt.Errorf("the value (%v) is not a single Character", v)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate a VCF file given as the first argument, the problems are written to stderr
+func ValidateVcf(cCtx *cli.Context) error {
+	logger := log.New(os.Stderr, "", 0)
+	if cCtx.Args().Len() != 1 {
+		return errors.New("expected one VCF file to validate")
+	}
+
+	reader, err := openVcf(cCtx.Args().First())
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	validator, problems := reader.Header.newVcfValidator(reader.Path, false)
+	for _, problem := range problems {
+		logger.Println(problem)
+	}
+
+	records := 0
+	invalidRecords := 0
+	for {
+		variant, ok, err := reader.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		records++
+		recordProblems := validator.validate(variant, reader.Line)
+		if len(recordProblems) != 0 {
+			invalidRecords++
+		}
+		for _, problem := range recordProblems {
+			logger.Println(problem)
+		}
+		problems = append(problems, recordProblems...)
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("found %v problem(s), %v of %v record(s) are invalid", len(problems), invalidRecords, records)
+	}
+	logger.Printf("%v record(s) are valid", records)
+	return nil
+}
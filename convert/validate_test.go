@@ -0,0 +1,135 @@
+package bedgovcf
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	header := Header{
+		HeaderLines: []HeaderLine{
+			newHeaderLine("INFO", "ID", "END", "Number", "1", "Type", "Integer"),
+			newHeaderLine("INFO", "ID", "AF", "Number", "A", "Type", "Float"),
+			newHeaderLine("INFO", "ID", "IMPRECISE", "Number", "0", "Type", "Flag"),
+			newHeaderLine("FORMAT", "ID", "GT", "Number", "1", "Type", "String"),
+			newHeaderLine("FORMAT", "ID", "PL", "Number", "G", "Type", "Integer"),
+			newHeaderLine("FORMAT", "ID", "FT", "Number", "1", "Type", "Character"),
+			newHeaderLine("FILTER", "ID", "LowQual"),
+			newHeaderLine("ALT", "ID", "DEL:ME"),
+		},
+	}
+	// The converted records are checked the way they are written
+	validator, problems := header.newVcfValidator("test.vcf", true)
+	if len(problems) != 0 {
+		t.Fatalf("Expected no header problems, got %v", problems)
+	}
+
+	valid := Variant{
+		Chrom:  "chr1",
+		Id:     "id_0",
+		Pos:    "10",
+		Ref:    "N",
+		Alt:    "<DEL:ME>,<DUP>",
+		Filter: "LOWQUAL",
+		Info: SliceVariantInfoFormat{
+			{Name: "end", Value: "20"},
+			{Name: "af", Value: "0.5,0.1"},
+			{Name: "imprecise", Value: "true"},
+		},
+		Format: SliceVariantInfoFormat{
+			{Name: "gt", Value: "0/1"},
+			{Name: "pl", Value: "1,2,3,4,5,6"},
+			{Name: "ft", Value: "."},
+		},
+	}
+	if problems := validator.validate(valid, 5); len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v", problems)
+	}
+
+	invalid := Variant{
+		Chrom:  "chr1",
+		Id:     "id_0",
+		Pos:    "10",
+		Ref:    "N",
+		Alt:    "<FOO>",
+		Filter: "HighQual",
+		Info: SliceVariantInfoFormat{
+			{Name: "end", Value: "20.5"},
+			{Name: "af", Value: "0.5,0.1"},
+			{Name: "svlen", Value: "10"},
+		},
+		Format: SliceVariantInfoFormat{
+			{Name: "ft", Value: "ab"},
+			{Name: "gt", Value: "0/1"},
+		},
+	}
+	problems = validator.validate(invalid, 6)
+	fields := []string{}
+	for _, problem := range problems {
+		var conversionError *ConversionError
+		if !errors.As(problem, &conversionError) || conversionError.Line != 6 {
+			t.Fatalf("Expected a ConversionError on line 6, got %v", problem)
+		}
+		fields = append(fields, conversionError.Field)
+	}
+	expected := []string{"ID", "ALT", "FILTER", "INFO/END", "INFO/AF", "INFO/SVLEN", "FORMAT/FT", "FORMAT/GT"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected problems in %v, got %v", expected, problems)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Fatalf("Expected problems in %v, got %v", expected, fields)
+		}
+	}
+
+	header = Header{HeaderLines: []HeaderLine{newHeaderLine("FORMAT", "ID", "X", "Number", "0", "Type", "Flag")}}
+	if _, problems := header.newVcfValidator("", false); len(problems) != 1 {
+		t.Fatalf("Expected a problem for a FORMAT Flag, got %v", problems)
+	}
+}
+
+func TestValidateCaseSensitive(t *testing.T) {
+	header := Header{
+		HeaderLines: []HeaderLine{
+			newHeaderLine("INFO", "ID", "IMPRECISE", "Number", "0", "Type", "Flag"),
+			newHeaderLine("INFO", "ID", "AC", "Number", "A", "Type", "Integer"),
+			newHeaderLine("FORMAT", "ID", "GT", "Number", "1", "Type", "String"),
+			newHeaderLine("FILTER", "ID", "LowQual"),
+		},
+	}
+	validator, _ := header.newVcfValidator("test.vcf", false)
+
+	valid := Variant{
+		Id:     ".",
+		Pos:    "10",
+		Alt:    "<DEL>",
+		Filter: "LowQual",
+		Info:   SliceVariantInfoFormat{{Name: "IMPRECISE", Value: ""}, {Name: "AC", Value: "1"}},
+		Format: SliceVariantInfoFormat{{Name: "GT", Value: "0/1"}},
+	}
+	if problems := validator.validate(valid, 5); len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v", problems)
+	}
+
+	// The IDs of a VCF file have to match exactly and Flag fields can't have a value
+	invalid := Variant{
+		Id:     ".",
+		Pos:    "10",
+		Alt:    "<DEL>",
+		Filter: "LOWQUAL",
+		Info:   SliceVariantInfoFormat{{Name: "IMPRECISE", Value: "true"}, {Name: "ac", Value: "1"}},
+		Format: SliceVariantInfoFormat{{Name: "gt", Value: "0/1"}},
+	}
+	fields := []string{}
+	for _, problem := range validator.validate(invalid, 6) {
+		var conversionError *ConversionError
+		if errors.As(problem, &conversionError) {
+			fields = append(fields, conversionError.Field)
+		}
+	}
+	expected := []string{"FILTER", "INFO/IMPRECISE", "INFO/ac", "FORMAT/gt"}
+	if !slices.Equal(fields, expected) {
+		t.Fatalf("Expected problems in %v, got %v", expected, fields)
+	}
+}
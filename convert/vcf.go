@@ -4,9 +4,13 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	cli "github.com/urfave/cli/v2"
 	"golang.org/x/text/cases"
@@ -15,11 +19,16 @@ import (
 
 // Set the header of the VCF struct according to the config and fai
 func (v *Vcf) SetHeader(cCtx *cli.Context, config Config) error {
-	err := v.Header.setVersion("4.2")
+	version, err := getVcfVersion(cCtx.String("vcf-version"), config)
+	if err != nil {
+		return err
+	}
+	err = v.Header.setVersion(version)
 	if err != nil {
 		return err
 	}
 
+	// The sample is set before the config is embedded, its value is embedded as well
 	if cCtx.String("sample") == "" {
 		err = v.Header.setSample(strings.Split(filepath.Base(cCtx.String("bed")), ".")[0])
 	} else {
@@ -29,12 +38,70 @@ func (v *Vcf) SetHeader(cCtx *cli.Context, config Config) error {
 		return err
 	}
 
+	v.Header.setProvenance(cCtx)
+	if cCtx.Bool("embed-config") {
+		err = v.Header.embedConfig(cCtx, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	config, warnings := config.withReservedFields(version)
+	for _, warning := range warnings {
+		logger := log.New(os.Stderr, "", 0)
+		logger.Printf("WARNING: %v", warning)
+	}
+
+	// Sites-only VCFs don't have FORMAT fields
+	v.Header.SitesOnly = cCtx.Bool("sites-only") || len(config.Format) == 0
+	if v.Header.SitesOnly {
+		config.Format = nil
+	}
+
 	err = v.Header.setHeaderLines(config)
 	if err != nil {
 		return err
 	}
 
-	err = v.Header.setContigs(cCtx.String("fai"))
+	err = v.Header.setContigsFromContext(cCtx, config)
+	if err != nil {
+		return err
+	}
+
+	if cCtx.String("header-template") != "" {
+		template, err := readHeaderTemplate(cCtx.String("header-template"))
+		if err != nil {
+			return err
+		}
+		for _, conflict := range v.Header.mergeTemplate(template) {
+			logger := log.New(os.Stderr, "", 0)
+			logger.Printf("WARNING: %v", conflict)
+		}
+	}
+
+	v.chromMapper, err = newChromMapper(cCtx.String("chrom-map"), cCtx.String("chrom-convention"))
+	if err != nil {
+		return err
+	}
+	if v.chromMapper != nil {
+		unmapped := v.Header.mapContigs(v.chromMapper)
+		if len(unmapped) != 0 {
+			logger := log.New(os.Stderr, "", 0)
+			logger.Printf("Could not translate the name of %v contig(s) in the header: %v", len(unmapped), strings.Join(unmapped, ", "))
+		}
+	}
+
+	if cCtx.Bool("restrict-contigs") {
+		selection, err := readRegions(cCtx)
+		if err != nil {
+			return err
+		}
+		// The selection is matched against the translated contig names
+		selection.mapChroms(v.chromMapper)
+		v.Header.restrictContigs(selection)
+	}
+
+	v.assemblyCheck, err = v.Header.newAssemblyCheck(cCtx)
 	if err != nil {
 		return err
 	}
@@ -45,62 +112,53 @@ func (v *Vcf) SetHeader(cCtx *cli.Context, config Config) error {
 // Set the header lines of the VCF struct according to the config
 func (h *Header) setHeaderLines(config Config) error {
 	for _, v := range config.Header {
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category: v.Name,
-			Content:  v.Content,
-		})
+		if len(v.Attributes) != 0 {
+			h.addLine(HeaderLine{Category: v.Name, Attributes: slices.Clone(v.Attributes)})
+		} else {
+			h.addLine(HeaderLine{Category: v.Name, Content: v.Content})
+		}
 	}
 
 	for _, v := range config.Alt.Options {
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category:    "ALT",
-			Id:          v.Name,
-			Description: v.Description,
-		})
+		h.addLine(newHeaderLine("ALT", "ID", v.Name, "Description", v.Description))
 	}
 
-	for _, v := range config.Info {
-		number := v.Number
-		if number == "" {
-			number = "."
-		}
-		typeField := v.Type
-		if typeField == "" {
-			typeField = "String"
+	for _, field := range []struct {
+		category string
+		fields   SliceConfigInfoFormatStruct
+	}{{"INFO", config.Info}, {"FORMAT", config.Format}} {
+		for _, v := range field.fields {
+			if !isValidFieldId(v.Name) {
+				return fmt.Errorf("the ID of %v field %v is not valid, IDs should start with a letter or an underscore and can only contain letters, digits, underscores and dots", field.category, v.Name)
+			}
+			number := v.Number
+			if number == "" {
+				number = "."
+			}
+			typeField := v.Type
+			if typeField == "" {
+				typeField = "String"
+			}
+			line := newHeaderLine(field.category, "ID", v.Name, "Number", number, "Type", typeField, "Description", v.Description)
+			for _, attribute := range v.Attributes {
+				line.set(attribute.Key, attribute.Value)
+			}
+			h.addLine(line)
 		}
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category:    "INFO",
-			Id:          v.Name,
-			Number:      number,
-			Type:        typeField,
-			Description: v.Description,
-		})
 	}
 
-	for _, v := range config.Format {
-		number := v.Number
-		if number == "" {
-			number = "."
-		}
-		typeField := v.Type
-		if typeField == "" {
-			typeField = "String"
-		}
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category:    "FORMAT",
-			Id:          v.Name,
-			Number:      number,
-			Type:        typeField,
-			Description: v.Description,
-		})
+	filters := []string{}
+	for _, v := range config.Filter.Options {
+		filters = append(filters, strings.ToUpper(v.Name))
+		h.addLine(newHeaderLine("FILTER", "ID", v.Name, "Description", v.Description))
 	}
 
-	for _, v := range config.Filter.Options {
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category:    "FILTER",
-			Id:          v.Name,
-			Description: v.Description,
-		})
+	for _, v := range config.Filter.Rules {
+		if slices.Contains(filters, strings.ToUpper(v.Name)) {
+			continue
+		}
+		filters = append(filters, strings.ToUpper(v.Name))
+		h.addLine(newHeaderLine("FILTER", "ID", v.Name, "Description", v.Description))
 	}
 
 	return nil
@@ -116,30 +174,91 @@ func (h *Header) setVersion(version string) error {
 	return nil
 }
 
-// Read the fasta index file and add the contigs to the VCF header
-func (h *Header) setContigs(faidx string) error {
+// Add the provenance header lines (fileDate, source and the command line), each line can be left out with its --no-* flag
+func (h *Header) setProvenance(cCtx *cli.Context) {
+	if !cCtx.Bool("no-date") {
+		h.addLine(HeaderLine{Category: "fileDate", Content: time.Now().Format("20060102")})
+	}
+	if !cCtx.Bool("no-source") {
+		source := "bedgovcf"
+		if cCtx.App != nil && cCtx.App.Version != "" {
+			source = fmt.Sprintf("bedgovcf v%v", cCtx.App.Version)
+		}
+		h.addLine(HeaderLine{Category: "source", Content: source})
+	}
+	if !cCtx.Bool("no-command") {
+		h.addLine(HeaderLine{Category: "bedgovcfCommand", Content: commandLine(os.Args)})
+	}
+}
 
-	file, err := os.Open(faidx)
-	if err != nil {
-		return fmt.Errorf("failed to open the fasta index file: %v", err)
+// Join the arguments of the command line, arguments with whitespace or shell characters are quoted
+func commandLine(args []string) string {
+	if len(args) == 0 {
+		return ""
 	}
-	defer file.Close()
+	command := []string{filepath.Base(args[0])}
+	for _, v := range args[1:] {
+		if v == "" || strings.ContainsAny(v, " \t\n'\"$`\\*?;&|<>(){}[]#~!") {
+			v = "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+		}
+		command = append(command, v)
+	}
+	return strings.Join(command, " ")
+}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.Split(scanner.Text(), "\t")
-		h.HeaderLines = append(h.HeaderLines, HeaderLine{
-			Category: "contig",
-			Id:       line[0],
-			Length:   line[1],
-		})
+// Only keep the contig header lines of the selected contigs
+func (h *Header) restrictContigs(selection *RegionSelection) {
+	if selection == nil {
+		return
 	}
-	return nil
+	h.HeaderLines = slices.DeleteFunc(h.HeaderLines, func(line HeaderLine) bool {
+		return strings.ToLower(line.Category) == "contig" && !selection.hasContig(line.id())
+	})
 }
 
 // Read the BED file and add the variants to the VCF struct
 func (v *Vcf) AddVariants(cCtx *cli.Context, config Config) error {
-	file, err := os.Open(cCtx.String("bed"))
+	logger := log.New(os.Stderr, "", 0)
+	bed := cCtx.String("bed")
+	config, _ = config.withReservedFields(v.Header.Version)
+	if v.Header.SitesOnly {
+		config.Format = nil
+	}
+	selection, err := readRegions(cCtx)
+	if err != nil {
+		return err
+	}
+	selection.mapChroms(v.chromMapper)
+
+	validator, err := newContigValidator(v.Header, cCtx.String("contig-policy"))
+	if err != nil {
+		return err
+	}
+	rowErrors, err := newRowErrorHandler(cCtx.String("error-policy"))
+	if err != nil {
+		return err
+	}
+	v.ids, err = newIdGenerator(config.Id, cCtx.String("duplicate-ids"))
+	if err != nil {
+		return err
+	}
+	v.groups, err = newVariantGroups(cCtx.String("split-by"), cCtx.String("output"))
+	if err != nil {
+		return err
+	}
+
+	// The sorter sorts the variants with --sort and compares consecutive variants with --assume-sorted
+	// Its temporary files are removed here unless they are needed by Write
+	sorter := newVariantSorter(v.Header, cCtx.Int64("sort-memory")*1024*1024, cCtx.String("tmp-dir"))
+	sorter.Groups = v.groups
+	defer func() {
+		if v.sorter != sorter {
+			sorter.cleanup()
+		}
+	}()
+	var previous *Variant
+
+	file, err := os.Open(bed)
 	if err != nil {
 		return fmt.Errorf("failed to open the bed file: %v", err)
 	}
@@ -148,8 +267,13 @@ func (v *Vcf) AddVariants(cCtx *cli.Context, config Config) error {
 	scanner := bufio.NewScanner(file)
 	header := []string{}
 	var skipCount int64
+	lineNumber := 0
+	droppedRows := 0
+	outsideRows := 0
+	unmappedChroms := []string{}
 
 	for scanner.Scan() {
+		lineNumber++
 		if skipCount < cCtx.Int64("skip") {
 			skipCount++
 			continue
@@ -168,63 +292,272 @@ func (v *Vcf) AddVariants(cCtx *cli.Context, config Config) error {
 		}
 
 		if len(line) != len(header) {
-			return errors.New("the amount of columns in the BED file is not consistent\n check if there aren't any additional lines at the top of the bed file (and use --skip to tell bedgovcf to skip these lines)")
+			return &ConversionError{
+				File: bed,
+				Line: lineNumber,
+				Err:  errors.New("the amount of columns in the BED file is not consistent\n check if there aren't any additional lines at the top of the bed file (and use --skip to tell bedgovcf to skip these lines)"),
+			}
 		}
 
-		variant := Variant{}
-
-		//Standard fields
-		variant.Chrom, err = config.Chrom.getValue(line, header)
+		keep, err := config.keepRow(line, header)
 		if err != nil {
-			return err
+			if err := rowErrors.handle(withLocation(err, bed, lineNumber)); err != nil {
+				return err
+			}
+			continue
 		}
-		variant.Pos, err = config.Pos.getValue(line, header)
-		if err != nil {
-			return err
+		if !keep {
+			droppedRows++
+			continue
 		}
-		variant.Id, err = config.Id.getValue(line, header)
-		if err != nil {
-			return err
+
+		variant, err := config.getVariant(line, header)
+		if err == nil {
+			err = variant.applyVersion(v.Header.Version)
 		}
-		variant.Ref, err = config.Ref.getValue(line, header)
 		if err != nil {
-			return err
+			if err := rowErrors.handle(withLocation(err, bed, lineNumber)); err != nil {
+				return err
+			}
+			continue
 		}
-		variant.Alt, err = config.Alt.getValue(line, header)
-		if err != nil {
-			return err
+
+		if v.chromMapper != nil {
+			chrom, ok := v.chromMapper.mapChrom(variant.Chrom)
+			if !ok && !slices.Contains(unmappedChroms, variant.Chrom) {
+				unmappedChroms = append(unmappedChroms, variant.Chrom)
+			}
+			variant.Chrom = chrom
 		}
-		variant.Qual, err = config.Qual.getValue(line, header)
-		if err != nil {
-			return err
+
+		if selection != nil {
+			inside, err := selection.containsVariant(variant)
+			if err != nil {
+				if err := rowErrors.handle(withLocation(err, bed, lineNumber)); err != nil {
+					return err
+				}
+				continue
+			}
+			if !inside {
+				outsideRows++
+				continue
+			}
+		}
+
+		if config.Id.Template != "" {
+			id, err := variant.fillTemplate(config.Id.Template, v.Header.Sample)
+			if err != nil {
+				if err := rowErrors.handle(withLocation(&ConversionError{Field: "ID", Expression: config.Id.Template, Err: err}, bed, lineNumber)); err != nil {
+					return err
+				}
+				continue
+			}
+			variant.Id = config.Id.Prefix + id
 		}
-		variant.Filter, err = config.Filter.getValue(line, header)
+
+		if violation := validator.check(variant); violation != nil {
+			violation = withLocation(violation, bed, lineNumber)
+			switch validator.Policy {
+			case "error":
+				return violation
+			case "warn":
+				validator.warn(violation)
+			case "drop":
+				continue
+			}
+		}
+
+		if v.assemblyCheck != nil {
+			v.assemblyCheck.observe(variant)
+		}
+
+		if cCtx.Bool("assume-sorted") {
+			if previous != nil && sorter.compare(*previous, variant) > 0 {
+				return &ConversionError{
+					File: bed,
+					Line: lineNumber,
+					Err:  fmt.Errorf("the records are not sorted: %v:%v comes after %v:%v, use --sort to sort the records", variant.Chrom, variant.Pos, previous.Chrom, previous.Pos),
+				}
+			}
+			previous = &variant
+		}
+
+		if v.groups != nil {
+			group, err := v.groups.group(variant, line, header)
+			if err != nil {
+				if err := rowErrors.handle(withLocation(err, bed, lineNumber)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := v.groups.assign(&variant, group); err != nil {
+				return withLocation(err, bed, lineNumber)
+			}
+		}
+
+		if cCtx.Bool("sort") {
+			err = sorter.add(variant)
+			if err != nil {
+				return err
+			}
+		} else {
+			v.Variants = append(v.Variants, variant)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read the bed file: %v", err)
+	}
+
+	// The records of each group are written together, so only one output file is open at a time
+	if cCtx.Bool("sort") {
+		if variants, ok := sorter.sorted(); ok {
+			v.Variants = append(v.Variants, variants...)
+		} else {
+			v.sorter = sorter
+		}
+	} else if v.groups != nil {
+		slices.SortStableFunc(v.Variants, v.groups.compare)
+	}
+
+	if v.assemblyCheck != nil {
+		err := v.assemblyCheck.check()
 		if err != nil {
 			return err
 		}
-		variant.Info, err = config.Info.getValues(line, header)
+	}
+	if len(unmappedChroms) != 0 {
+		logger.Printf("Could not translate the name of %v chromosome(s) in the BED file: %v", len(unmappedChroms), strings.Join(unmappedChroms, ", "))
+	}
+	for _, v := range validator.summary() {
+		logger.Println(v)
+	}
+	if selection != nil {
+		logger.Printf("Dropped %v row(s) outside of the selected regions", outsideRows)
+	}
+	if config.Include != "" || config.Exclude != "" {
+		logger.Printf("Dropped %v row(s) that didn't pass the include/exclude filters", droppedRows)
+	}
+	if rowErrors.Dropped != 0 {
+		logger.Printf("Dropped %v row(s) that could not be converted", rowErrors.Dropped)
+	}
+
+	return nil
+}
+
+// Check if a line of the BED file passes the include and exclude filters of the config
+func (c *Config) keepRow(line []string, header []string) (bool, error) {
+	if c.Include != "" {
+		include, err := resolveCondition(strings.Fields(c.Include), line, header)
 		if err != nil {
-			return err
+			return false, &ConversionError{Field: "include", Expression: c.Include, Err: err}
+		}
+		if !include {
+			return false, nil
 		}
-		variant.Format, err = config.Format.getValues(line, header)
+	}
+
+	if c.Exclude != "" {
+		exclude, err := resolveCondition(strings.Fields(c.Exclude), line, header)
 		if err != nil {
-			return err
+			return false, &ConversionError{Field: "exclude", Expression: c.Exclude, Err: err}
+		}
+		if exclude {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Convert one line of the BED file to a variant according to the config
+func (c *Config) getVariant(line []string, header []string) (Variant, error) {
+	var err error
+	variant := Variant{}
+
+	//Standard fields
+	standardFields := []struct {
+		name   string
+		config ConfigStandardFieldStruct
+		value  *string
+	}{
+		{"CHROM", c.Chrom, &variant.Chrom},
+		{"POS", c.Pos, &variant.Pos},
+		{"ID", c.Id, &variant.Id},
+		{"REF", c.Ref, &variant.Ref},
+		{"ALT", c.Alt, &variant.Alt},
+		{"QUAL", c.Qual, &variant.Qual},
+		{"FILTER", c.Filter, &variant.Filter},
+	}
+	for _, field := range standardFields {
+		*field.value, err = field.config.getValue(line, header)
+		var conversionError *ConversionError
+		if errors.As(err, &conversionError) {
+			return Variant{}, err
+		} else if err != nil {
+			return Variant{}, &ConversionError{Field: field.name, Expression: field.config.Value, Err: err}
 		}
+	}
 
-		v.Variants = append(v.Variants, variant)
+	variant.Info, err = c.Info.getValues("INFO", line, header, c.Rounding)
+	if err != nil {
+		return Variant{}, err
+	}
+	variant.Format, err = c.Format.getValues("FORMAT", line, header, c.Rounding)
+	if err != nil {
+		return Variant{}, err
 	}
 
-	return nil
+	return variant, nil
+}
+
+// Add the input file and line number to a conversion error
+func withLocation(err error, file string, line int) error {
+	var conversionError *ConversionError
+	if errors.As(err, &conversionError) {
+		conversionError.File = file
+		conversionError.Line = line
+		return conversionError
+	}
+	return &ConversionError{File: file, Line: line, Err: err}
 }
 
 // Get the values of all info fields and transform them to a map
-func (mcifs *SliceConfigInfoFormatStruct) getValues(values []string, header []string) (SliceVariantInfoFormat, error) {
+func (mcifs *SliceConfigInfoFormatStruct) getValues(category string, values []string, header []string, rounding string) (SliceVariantInfoFormat, error) {
 	infoMap := SliceVariantInfoFormat{}
 	for _, v := range *mcifs {
-		value, err := v.getValue(values, header)
-		if err != nil {
-			return nil, err
+		field := fmt.Sprintf("%v/%v", category, strings.ToUpper(v.Name))
+		value := "."
+		when := true
+		if v.When != "" {
+			var err error
+			when, err = resolveCondition(strings.Fields(v.When), values, header)
+			if err != nil {
+				return nil, &ConversionError{Field: field, Expression: v.When, Err: err}
+			}
+		}
+
+		if when {
+			var err error
+			value, err = v.getValue(values, header)
+			if err != nil {
+				return nil, &ConversionError{Field: field, Expression: v.Value, Err: err}
+			}
+			value, err = coerceValue(value, v.Type, rounding)
+			if err != nil {
+				return nil, &ConversionError{Field: field, Expression: v.Value, Err: err}
+			}
 		}
+
+		if strings.ToLower(v.Type) == "flag" {
+			// Flags without a value are always set when the condition is true
+			if when && (v.Value == "" || isTrue(value)) {
+				value = "true"
+			} else {
+				value = "."
+			}
+		}
+
 		infoMap = append(infoMap, VariantInfoFormat{
 			Name:   v.Name,
 			Number: v.Number,
@@ -235,6 +568,16 @@ func (mcifs *SliceConfigInfoFormatStruct) getValues(values []string, header []st
 	return infoMap, nil
 }
 
+// Check if a resolved value should be interpreted as true
+func isTrue(value string) bool {
+	return !slices.Contains([]string{"", ".", "0", "false", "no"}, strings.ToLower(value))
+}
+
+// Check if a resolved value is missing
+func isMissing(value string) bool {
+	return value == "" || value == "."
+}
+
 // Get the value for the given field based on the config
 func (cifs *ConfigInfoFormatStruct) getValue(values []string, header []string) (string, error) {
 	var prefix string
@@ -253,6 +596,10 @@ func (cifs *ConfigInfoFormatStruct) getValue(values []string, header []string) (
 
 // Get the value for the given field based on the config
 func (csfs *ConfigStandardFieldStruct) getValue(values []string, header []string) (string, error) {
+	if len(csfs.Rules) != 0 {
+		return csfs.getFilters(values, header)
+	}
+
 	var prefix string
 	if csfs.Prefix != "" {
 		prefix = csfs.Prefix
@@ -267,55 +614,235 @@ func (csfs *ConfigStandardFieldStruct) getValue(values []string, header []string
 
 }
 
+// Compose the filter value from all rules that apply to the given line
+func (csfs *ConfigStandardFieldStruct) getFilters(values []string, header []string) (string, error) {
+	filters := []string{}
+	for _, rule := range csfs.Rules {
+		applies, err := resolveCondition(strings.Fields(rule.Condition), values, header)
+		if err != nil {
+			return "", &ConversionError{Field: fmt.Sprintf("FILTER/%v", rule.Name), Expression: rule.Condition, Err: err}
+		}
+		if applies {
+			filters = append(filters, strings.ToUpper(rule.Name))
+		}
+	}
+
+	if len(filters) == 0 {
+		return "PASS", nil
+	}
+	return strings.Join(filters, ";"), nil
+}
+
 // Write the VCF struct to stdout or a file
+// With --split-by, the records are written to one file per group
 func (v *Vcf) Write(cCtx *cli.Context) error {
-	stdout := true
-	if cCtx.String("output") != "" {
-		stdout = false
+	logger := log.New(os.Stderr, "", 0)
+	// The temporary files of the sorter are removed on every return, also when no variant was written
+	if v.sorter != nil {
+		defer v.sorter.cleanup()
+	}
+	output := cCtx.String("output")
+	outputFormat, err := getOutputFormat(cCtx.String("output-format"), output)
+	if err != nil {
+		return err
+	}
+	compress := outputFormat == "bcf" || cCtx.Bool("compress") || strings.HasSuffix(output, ".gz") || strings.HasSuffix(output, ".bgz")
+	indexFormat, err := v.Header.indexFormat(cCtx.String("index"), outputFormat)
+	if err != nil {
+		return err
+	}
+	if indexFormat != "" && (output == "" || !compress) {
+		return errors.New("an index can only be created for a compressed output file (use --output with a .gz or .bcf extension)")
 	}
 
-	if stdout {
-		fmt.Print(v.Header.String())
-		for count, variant := range v.Variants {
-			fmt.Print(variant.String(count))
+	ids := v.ids
+	if ids == nil {
+		ids, err = newIdGenerator(ConfigStandardFieldStruct{}, cCtx.String("duplicate-ids"))
+		if err != nil {
+			return err
 		}
-	} else {
-		file, err := os.Create(cCtx.String("output"))
+	}
+
+	// The records are ordered by group, an output is finished before the output of the next group is created
+	// The outputs are only moved to their paths when all of them have been finished
+	outputs := []*VcfOutput{}
+	defer func() {
+		for _, vo := range outputs {
+			vo.abort()
+		}
+	}()
+	if v.groups == nil {
+		vo, err := newVcfOutput(cCtx, output, v.Header, outputFormat, indexFormat)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, vo)
+	}
+
+	finished := map[string]bool{}
+	group := ""
+	err = v.eachVariant(func(count int, variant Variant) error {
+		variant.Id, err = ids.assign(variant.Id, count)
 		if err != nil {
-			return fmt.Errorf("failed to create the output file: %v", err)
+			return err
+		}
+		if len(outputs) == 0 || variant.Group != group {
+			if finished[variant.Group] {
+				return fmt.Errorf("the records of the group %v are not written together", variant.Group)
+			}
+			if len(outputs) != 0 {
+				finished[group] = true
+				if err := outputs[len(outputs)-1].finish(); err != nil {
+					return err
+				}
+			}
+			group = variant.Group
+			header := v.groups.header(v.Header, group, cCtx.Bool("split-restrict-contigs"))
+			vo, err := newVcfOutput(cCtx, groupPath(output, group), header, outputFormat, indexFormat)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, vo)
+		}
+		return outputs[len(outputs)-1].write(variant)
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(outputs) != 0 {
+		if err := outputs[len(outputs)-1].finish(); err != nil {
+			return err
 		}
-		defer file.Close()
-		file.WriteString(v.Header.String())
-		for count, variant := range v.Variants {
-			file.WriteString(variant.String(count))
+	}
+	for _, vo := range outputs {
+		if err := vo.commit(); err != nil {
+			return err
 		}
 	}
+	if v.groups != nil {
+		logger.Println(v.groups)
+	}
+	if ids.Duplicates != 0 {
+		logger.Printf("Found %v duplicate ID(s) in the output", ids.Duplicates)
+	}
 	return nil
 }
 
-// Convert a variant to a string
-func (v Variant) String(count int) string {
+// Determine the output format, files ending with .bcf are written as BCF by default
+func getOutputFormat(format string, output string) (string, error) {
+	switch strings.ToLower(format) {
+	case "":
+		if strings.HasSuffix(output, ".bcf") {
+			return "bcf", nil
+		}
+		return "vcf", nil
+	case "vcf", "bcf":
+		return strings.ToLower(format), nil
+	}
+	return "", fmt.Errorf("the output format (%v) is not supported, use 'vcf' or 'bcf'", format)
+}
+
+// Determine the index format, 'auto' uses CSI when a contig is too long for tabix or when the output is BCF
+func (h *Header) indexFormat(format string, outputFormat string) (string, error) {
+	switch format {
+	case "":
+		return "", nil
+	case "auto":
+		if outputFormat == "bcf" || h.maxContigLength() > tabixMaxEnd {
+			return "csi", nil
+		}
+		return "tbi", nil
+	case "tbi":
+		if outputFormat == "bcf" {
+			return "", errors.New("BCF files can only be indexed with a CSI index")
+		}
+		return format, nil
+	case "csi":
+		return format, nil
+	}
+	return "", fmt.Errorf("the index format (%v) is not supported, use 'tbi', 'csi' or 'auto'", format)
+}
 
-	id := fmt.Sprintf("%v%v", v.Id, count)
+// Get the length of the largest contig in the header
+func (h *Header) maxContigLength() int64 {
+	var maxLength int64
+	for _, length := range h.contigLengths() {
+		maxLength = max(maxLength, length)
+	}
+	return maxLength
+}
 
-	variant := strings.Join([]string{
+// Get the interval of a variant (0-based, half-open), the END INFO field is used when present
+// An END before the POS is ignored, the same as htslib does
+func (v Variant) interval() (int64, int64, error) {
+	pos, err := strconv.ParseInt(v.Pos, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse the position (%v) of the record on %v to an integer", v.Pos, v.Chrom)
+	}
+	beg := pos - 1
+	end := beg + int64(max(len(v.Ref), 1))
+	for _, info := range v.Info {
+		if strings.ToUpper(info.Name) != "END" || isMissing(info.Value) {
+			continue
+		}
+		infoEnd, err := strconv.ParseInt(info.Value, 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse the end (%v) of the record at %v:%v to an integer", info.Value, v.Chrom, v.Pos)
+		}
+		if infoEnd > beg {
+			end = infoEnd
+		}
+	}
+	return beg, end, nil
+}
+
+// Call the callback for every variant of the VCF in output order
+func (v *Vcf) eachVariant(callback func(count int, variant Variant) error) error {
+	count := 0
+	for _, variant := range v.Variants {
+		if err := callback(count, variant); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if v.sorter != nil {
+		return v.sorter.each(func(variant Variant) error {
+			err := callback(count, variant)
+			count++
+			return err
+		})
+	}
+	return nil
+}
+
+// Convert a variant to a string
+// The FORMAT and sample columns are left out when the variant has no FORMAT fields (sites-only)
+func (v Variant) String() string {
+	columns := []string{
 		v.Chrom,
 		v.Pos,
-		id,
+		v.Id,
 		v.Ref,
 		v.Alt,
 		v.Qual,
 		v.Filter,
 		v.Info.infoString(),
-		v.Format.formatString(),
-	}, "\t")
-	return variant + "\n"
+	}
+	if len(v.Format) != 0 {
+		columns = append(columns, v.Format.formatString())
+	}
+	return strings.Join(columns, "\t") + "\n"
 }
 
 // Convert the info map to a string
 func (mvif SliceVariantInfoFormat) infoString() string {
 	var infoSlice []string
 	for _, v := range mvif {
+		if isMissing(v.Value) {
+			continue
+		}
 		upperInfo := strings.ToUpper(v.Name)
 		switch infoType := strings.ToLower(v.Type); infoType {
 		case "flag":
@@ -325,6 +852,9 @@ func (mvif SliceVariantInfoFormat) infoString() string {
 		}
 	}
 
+	if len(infoSlice) == 0 {
+		return "."
+	}
 	return strings.Join(infoSlice, ";")
 }
 
@@ -335,7 +865,11 @@ func (mvif SliceVariantInfoFormat) formatString() string {
 	for _, v := range mvif {
 		upperFormat := strings.ToUpper(v.Name)
 		formatField = append(formatField, upperFormat)
-		formatValues = append(formatValues, v.Value)
+		if isMissing(v.Value) {
+			formatValues = append(formatValues, ".")
+		} else {
+			formatValues = append(formatValues, v.Value)
+		}
 	}
 
 	return strings.Join(formatField, ":") + "\t" + strings.Join(formatValues, ":")
@@ -343,29 +877,73 @@ func (mvif SliceVariantInfoFormat) formatString() string {
 
 // Convert the VCF header to a string
 func (h Header) String() string {
-	header := ""
-	header += fmt.Sprintf("##fileformat=VCFv%v\n", h.Version)
+	var header strings.Builder
+	fmt.Fprintf(&header, "##fileformat=VCFv%v\n", h.Version)
 	for _, v := range h.HeaderLines {
-		header += fmt.Sprintf("%v\n", v.String())
+		header.WriteString(v.String())
+		header.WriteByte('\n')
 	}
-	header += fmt.Sprintf("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t%v\n", h.Sample)
-	return header
+	if h.SitesOnly {
+		header.WriteString("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	} else {
+		fmt.Fprintf(&header, "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tFORMAT\t%v\n", h.Sample)
+	}
+	return header.String()
 }
 
 // Convert the VCF header line to a string
+// The IDs of INFO, FORMAT, ALT and FILTER lines are written in uppercase, verbatim lines are written as they were read
 func (h HeaderLine) String() string {
-	line := ""
-	switch category := strings.ToLower(h.Category); category {
+	if len(h.Attributes) == 0 {
+		return fmt.Sprintf("##%v=%v", h.Category, h.Content)
+	}
+
+	category := h.Category
+	definition := false
+	switch strings.ToLower(category) {
 	case "contig":
-		line = fmt.Sprintf("##%v=<ID=%v,length=%v>", strings.ToLower(h.Category), h.Id, h.Length)
-	case "info", "format":
-		lineType := cases.Title(language.English, cases.Compact).String(strings.ToLower(h.Type))
-		line = fmt.Sprintf("##%v=<ID=%v,Number=%v,Type=%v,Description=\"%v\">", strings.ToUpper(h.Category), strings.ToUpper(h.Id), h.Number, lineType, h.Description)
-	case "alt", "filter":
-		line = fmt.Sprintf("##%v=<ID=%v,Description=\"%v\">", strings.ToUpper(h.Category), strings.ToUpper(h.Id), h.Description)
-	default:
-		line = fmt.Sprintf("##%v=%v", h.Category, h.Content)
+		category = "contig"
+	case "info", "format", "alt", "filter":
+		category = strings.ToUpper(category)
+		definition = true
+	}
+	if h.Verbatim {
+		category = h.Category
+		definition = false
 	}
 
-	return line
+	attributes := []string{}
+	for _, v := range h.Attributes {
+		value := v.Value
+		if definition && strings.EqualFold(v.Key, "ID") {
+			value = h.writtenId()
+		}
+		if definition && strings.EqualFold(v.Key, "Type") {
+			value = cases.Title(language.English, cases.Compact).String(strings.ToLower(value))
+		}
+		if needsQuotes(v.Key, value) {
+			value = quote(value)
+		}
+		attributes = append(attributes, fmt.Sprintf("%v=%v", v.Key, value))
+	}
+	return fmt.Sprintf("##%v=<%v>", category, strings.Join(attributes, ","))
+}
+
+// The ID of the header line as it is written, the IDs of INFO, FORMAT, ALT and FILTER lines are written in uppercase
+func (h HeaderLine) writtenId() string {
+	if h.Verbatim {
+		return h.id()
+	}
+	switch strings.ToLower(h.Category) {
+	case "info", "format", "alt", "filter":
+		return strings.ToUpper(h.id())
+	}
+	return h.id()
+}
+
+// Surround a header value with double quotes, escaping the backslashes and double quotes inside it
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return fmt.Sprintf("\"%v\"", value)
 }
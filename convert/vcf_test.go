@@ -1,7 +1,12 @@
 package bedgovcf
 
 import (
+	"errors"
+	"flag"
+	"reflect"
 	"testing"
+
+	cli "github.com/urfave/cli/v2"
 )
 
 func TestSetVersion(t *testing.T) {
@@ -20,28 +25,29 @@ func TestSetSample(t *testing.T) {
 	}
 }
 
+// Add the contigs of the test fasta index to the header
+func addTestContigs(t *testing.T, header *Header) {
+	contigs, err := readFai("../test_data/test.fai")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	header.addContigs(contigs)
+}
+
 func TestSetContigs(t *testing.T) {
 	header := Header{}
-	header.setContigs("../test_data/test.fai")
+	addTestContigs(t, &header)
 	if len(header.HeaderLines) != 2 {
 		t.Fatalf("Expected 2 contigs, got %d", len(header.HeaderLines))
 	}
-	contig0 := HeaderLine{
-		Category: "contig",
-		Id:       "chr1",
-		Length:   "248956422",
-	}
+	contig0 := newHeaderLine("contig", "ID", "chr1", "length", "248956422")
 
-	contig1 := HeaderLine{
-		Category: "contig",
-		Id:       "chr2",
-		Length:   "242193529",
-	}
+	contig1 := newHeaderLine("contig", "ID", "chr2", "length", "242193529")
 
-	if header.HeaderLines[0] != contig0 {
+	if !reflect.DeepEqual(header.HeaderLines[0], contig0) {
 		t.Fatalf("Expected contig 0 to be %v, got %v", contig0, header.HeaderLines[0])
 	}
-	if header.HeaderLines[1] != contig1 {
+	if !reflect.DeepEqual(header.HeaderLines[1], contig1) {
 		t.Fatalf("Expected contig 1 to be %v, got %v", contig1, header.HeaderLines[1])
 	}
 }
@@ -100,43 +106,23 @@ func TestSetHeaderLines(t *testing.T) {
 		Category: "test",
 		Content:  "test",
 	}
-	headerLine1 := HeaderLine{
-		Category:    "ALT",
-		Id:          "DUP",
-		Description: "Duplication",
-	}
-	headerLine2 := HeaderLine{
-		Category:    "INFO",
-		Id:          "SVLEN",
-		Description: "The length of the SV",
-		Number:      "1",
-		Type:        "Integer",
-	}
-	headerLine3 := HeaderLine{
-		Category:    "FORMAT",
-		Id:          "GT",
-		Description: "Genotype",
-		Number:      "1",
-		Type:        "String",
-	}
-	headerLine4 := HeaderLine{
-		Category:    "FILTER",
-		Id:          "PASS",
-		Description: "Passed filters",
-	}
-	if header.HeaderLines[0] != headerLine0 {
+	headerLine1 := newHeaderLine("ALT", "ID", "DUP", "Description", "Duplication")
+	headerLine2 := newHeaderLine("INFO", "ID", "SVLEN", "Number", "1", "Type", "Integer", "Description", "The length of the SV")
+	headerLine3 := newHeaderLine("FORMAT", "ID", "GT", "Number", "1", "Type", "String", "Description", "Genotype")
+	headerLine4 := newHeaderLine("FILTER", "ID", "PASS", "Description", "Passed filters")
+	if !reflect.DeepEqual(header.HeaderLines[0], headerLine0) {
 		t.Fatalf("Expected header line 0 to be %v, got %v", headerLine0, header.HeaderLines[0])
 	}
-	if header.HeaderLines[1] != headerLine1 {
+	if !reflect.DeepEqual(header.HeaderLines[1], headerLine1) {
 		t.Fatalf("Expected header line 1 to be %v, got %v", headerLine1, header.HeaderLines[1])
 	}
-	if header.HeaderLines[2] != headerLine2 {
+	if !reflect.DeepEqual(header.HeaderLines[2], headerLine2) {
 		t.Fatalf("Expected header line 2 to be %v, got %v", headerLine2, header.HeaderLines[2])
 	}
-	if header.HeaderLines[3] != headerLine3 {
+	if !reflect.DeepEqual(header.HeaderLines[3], headerLine3) {
 		t.Fatalf("Expected header line 3 to be %v, got %v", headerLine3, header.HeaderLines[3])
 	}
-	if header.HeaderLines[4] != headerLine4 {
+	if !reflect.DeepEqual(header.HeaderLines[4], headerLine4) {
 		t.Fatalf("Expected header line 4 to be %v, got %v", headerLine4, header.HeaderLines[4])
 	}
 
@@ -208,7 +194,7 @@ func TestVariantString(t *testing.T) {
 	variant := Variant{
 		Chrom:  "chr1",
 		Pos:    "123",
-		Id:     "test",
+		Id:     "test1",
 		Ref:    "A",
 		Alt:    "C",
 		Qual:   "100",
@@ -231,14 +217,14 @@ func TestVariantString(t *testing.T) {
 		},
 	}
 
-	if variant.String(1) != "chr1\t123\ttest1\tA\tC\t100\tPASS\tSVLEN=100\tGT\t0/1\n" {
-		t.Fatalf("Expected variant string to be 'chr1\t123\ttest\tA\tC\t100\tPASS\tSVLEN=100\tGT\t0/1\n', got '%s'", variant.String(1))
+	if variant.String() != "chr1\t123\ttest1\tA\tC\t100\tPASS\tSVLEN=100\tGT\t0/1\n" {
+		t.Fatalf("Expected variant string to be 'chr1\t123\ttest\tA\tC\t100\tPASS\tSVLEN=100\tGT\t0/1\n', got '%s'", variant.String())
 	}
 
 	variant = Variant{
 		Chrom:  "chr1",
 		Pos:    "123",
-		Id:     "test",
+		Id:     "test1",
 		Ref:    "A",
 		Alt:    "C",
 		Qual:   "100",
@@ -273,8 +259,8 @@ func TestVariantString(t *testing.T) {
 		},
 	}
 
-	if variant.String(1) != "chr1	123	test1	A	C	100	PASS	SVLEN=100;SVTYPE=DEL	GT:CN	0/1:2\n" {
-		t.Fatalf("Expected variant string to be 'chr1	123	test1	A	C	100	PASS	SVLEN=100;SVTYPE=DEL	GT:CN	0/1:2\n', got '%s'", variant.String(1))
+	if variant.String() != "chr1	123	test1	A	C	100	PASS	SVLEN=100;SVTYPE=DEL	GT:CN	0/1:2\n" {
+		t.Fatalf("Expected variant string to be 'chr1	123	test1	A	C	100	PASS	SVLEN=100;SVTYPE=DEL	GT:CN	0/1:2\n', got '%s'", variant.String())
 	}
 
 }
@@ -288,23 +274,9 @@ func TestHeader(t *testing.T) {
 				Category: "test",
 				Content:  "test",
 			},
-			{
-				Category:    "ALT",
-				Id:          "DEL",
-				Description: "Deletion",
-			},
-			{
-				Category: "contig",
-				Id:       "chr1",
-				Length:   "123",
-			},
-			{
-				Category:    "INFO",
-				Id:          "SVLEN",
-				Number:      "1",
-				Type:        "Integer",
-				Description: "The length of the structural variant",
-			},
+			newHeaderLine("ALT", "ID", "DEL", "Description", "Deletion"),
+			newHeaderLine("contig", "ID", "chr1", "length", "123"),
+			newHeaderLine("INFO", "ID", "SVLEN", "Number", "1", "Type", "Integer", "Description", "The length of the structural variant"),
 		},
 	}
 
@@ -319,3 +291,218 @@ func TestHeader(t *testing.T) {
 		t.Fatalf("Expected header string to be '%s', got '%s'", testString, header.String())
 	}
 }
+
+func TestGetVariantError(t *testing.T) {
+	config := Config{
+		Chrom: ConfigStandardFieldStruct{Value: "$0"},
+		Pos:   ConfigStandardFieldStruct{Value: "$1"},
+		Info: SliceConfigInfoFormatStruct{
+			{
+				Name:  "svlen",
+				Value: "~min $2 $1",
+			},
+		},
+	}
+	header := []string{"0", "1", "2"}
+	_, err := config.getVariant([]string{"chr1", "1", "NA"}, header)
+	err = withLocation(err, "test.bed", 3)
+
+	var conversionError *ConversionError
+	if !errors.As(err, &conversionError) {
+		t.Fatalf("Expected a ConversionError, got %v", err)
+	}
+	if conversionError.File != "test.bed" || conversionError.Line != 3 {
+		t.Fatalf("Expected the error to point to test.bed:3, got %v:%v", conversionError.File, conversionError.Line)
+	}
+	if conversionError.Field != "INFO/SVLEN" {
+		t.Fatalf("Expected the field to be INFO/SVLEN, got %s", conversionError.Field)
+	}
+	if conversionError.Expression != "~min $2 $1" {
+		t.Fatalf("Expected the expression to be '~min $2 $1', got %s", conversionError.Expression)
+	}
+
+	expected := "test.bed:3 INFO/SVLEN (~min $2 $1): failed to parse the value (NA) to a float: strconv.ParseFloat: parsing \"NA\": invalid syntax"
+	if err.Error() != expected {
+		t.Fatalf("Expected error to be '%s', got '%s'", expected, err.Error())
+	}
+}
+
+func TestKeepRow(t *testing.T) {
+	header := []string{"0", "1", "2", "3"}
+	config := Config{
+		Include: "~min $2 $1 >= 1000",
+		Exclude: "$3 == 2",
+	}
+
+	keep, _ := config.keepRow([]string{"chr1", "0", "5000", "3"}, header)
+	if !keep {
+		t.Fatalf("Expected a long gain to be kept")
+	}
+
+	keep, _ = config.keepRow([]string{"chr1", "0", "500", "3"}, header)
+	if keep {
+		t.Fatalf("Expected a segment shorter than 1kb to be dropped")
+	}
+
+	keep, _ = config.keepRow([]string{"chr1", "0", "5000", "2"}, header)
+	if keep {
+		t.Fatalf("Expected a neutral segment to be dropped")
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	header := []string{"0", "1", "2", "3"}
+	config := ConfigStandardFieldStruct{
+		Rules: []ConfigFilterRuleStruct{
+			{
+				Name:        "LowQual",
+				Description: "Low quality",
+				Condition:   "$3 < 10",
+			},
+			{
+				Name:        "Small",
+				Description: "Shorter than 1kb",
+				Condition:   "~min $2 $1 < 1000",
+			},
+		},
+	}
+
+	value, _ := config.getValue([]string{"chr1", "0", "500", "5"}, header)
+	if value != "LOWQUAL;SMALL" {
+		t.Fatalf("Expected value to be 'LOWQUAL;SMALL', got %s", value)
+	}
+
+	value, _ = config.getValue([]string{"chr1", "0", "5000", "5"}, header)
+	if value != "LOWQUAL" {
+		t.Fatalf("Expected value to be 'LOWQUAL', got %s", value)
+	}
+
+	value, _ = config.getValue([]string{"chr1", "0", "5000", "50"}, header)
+	if value != "PASS" {
+		t.Fatalf("Expected value to be 'PASS', got %s", value)
+	}
+
+	headerStruct := Header{}
+	headerStruct.setHeaderLines(Config{Filter: config})
+	if len(headerStruct.HeaderLines) != 2 {
+		t.Fatalf("Expected 2 header lines, got %d", len(headerStruct.HeaderLines))
+	}
+	expected := newHeaderLine("FILTER", "ID", "Small", "Description", "Shorter than 1kb")
+	if !reflect.DeepEqual(headerStruct.HeaderLines[1], expected) {
+		t.Fatalf("Expected header line 1 to be %v, got %v", expected, headerStruct.HeaderLines[1])
+	}
+}
+
+func TestConditionalInfoFormat(t *testing.T) {
+	header := []string{"0", "1", "2", "3"}
+	info := SliceConfigInfoFormatStruct{
+		{
+			Name:  "imprecise",
+			Type:  "Flag",
+			Value: "~if $3 < 10 true false",
+		},
+		{
+			Name: "lowcn",
+			Type: "Flag",
+			When: "$3 < 2",
+		},
+		{
+			Name:  "ratio",
+			Value: "$3",
+			When:  "$3 != NA",
+		},
+	}
+	format := SliceConfigInfoFormatStruct{
+		{
+			Name:  "gt",
+			Value: "0/1",
+		},
+		{
+			Name:  "cn",
+			Value: "$3",
+			When:  "$3 != NA",
+		},
+	}
+
+	values, _ := info.getValues("INFO", []string{"chr1", "0", "100", "5"}, header, "round")
+	if values.infoString() != "IMPRECISE;RATIO=5" {
+		t.Fatalf("Expected info string to be 'IMPRECISE;RATIO=5', got '%s'", values.infoString())
+	}
+
+	values, _ = info.getValues("INFO", []string{"chr1", "0", "100", "1"}, header, "round")
+	if values.infoString() != "IMPRECISE;LOWCN;RATIO=1" {
+		t.Fatalf("Expected info string to be 'IMPRECISE;LOWCN;RATIO=1', got '%s'", values.infoString())
+	}
+
+	values, _ = info.getValues("INFO", []string{"chr1", "0", "100", "20"}, header, "round")
+	if values.infoString() != "RATIO=20" {
+		t.Fatalf("Expected info string to be 'RATIO=20', got '%s'", values.infoString())
+	}
+
+	values, _ = format.getValues("FORMAT", []string{"chr1", "0", "100", "NA"}, header, "round")
+	if values.formatString() != "GT:CN\t0/1:." {
+		t.Fatalf("Expected format string to be 'GT:CN\t0/1:.', got '%s'", values.formatString())
+	}
+}
+
+func TestHeaderLineEscaping(t *testing.T) {
+	line := newHeaderLine("INFO", "ID", "note", "Number", "1", "Type", "String", "Description", `A "quoted" C:\path`)
+	expected := `##INFO=<ID=NOTE,Number=1,Type=String,Description="A \"quoted\" C:\\path">`
+	if line.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, line.String())
+	}
+
+	line = newHeaderLine("FILTER", "ID", "q", "Description", `Quality < "10"`)
+	expected = `##FILTER=<ID=Q,Description="Quality < \"10\"">`
+	if line.String() != expected {
+		t.Fatalf("Expected %v, got %v", expected, line.String())
+	}
+}
+
+func TestSitesOnly(t *testing.T) {
+	header := Header{Version: "4.2", Sample: "test", SitesOnly: true}
+	expectedHeader := "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"
+	if header.String() != expectedHeader {
+		t.Fatalf("Expected %q, got %q", expectedHeader, header.String())
+	}
+
+	variant := Variant{Chrom: "chr1", Pos: "1", Id: "id_0", Ref: "N", Alt: "<DEL>", Qual: ".", Filter: "PASS"}
+	expected := "chr1\t1\tid_0\tN\t<DEL>\t.\tPASS\t.\n"
+	if variant.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, variant.String())
+	}
+
+	variant.Info = SliceVariantInfoFormat{{Name: "svlen", Value: "."}}
+	if variant.String() != expected {
+		t.Fatalf("Expected an empty INFO column to be written as '.', got %q", variant.String())
+	}
+
+	variant.Format = SliceVariantInfoFormat{{Name: "gt", Value: "0/1"}}
+	expected = "chr1\t1\tid_0\tN\t<DEL>\t.\tPASS\t.\tGT\t0/1\n"
+	if variant.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, variant.String())
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	command := commandLine([]string{"/usr/bin/bedgovcf", "--bed", "my file.bed", "--split-by", "$4", "-o", "out.vcf"})
+	expected := "bedgovcf --bed 'my file.bed' --split-by '$4' -o out.vcf"
+	if command != expected {
+		t.Fatalf("Expected %v, got %v", expected, command)
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.Bool("no-date", true, "")
+	set.Bool("no-command", false, "")
+	cCtx := cli.NewContext(&cli.App{Version: "1.0.0"}, set, nil)
+	set.Parse([]string{"--no-command"})
+
+	header := Header{}
+	header.setProvenance(cCtx)
+	if len(header.HeaderLines) != 1 {
+		t.Fatalf("Expected only the source header line, got %v", header.HeaderLines)
+	}
+	if line := header.HeaderLines[0].String(); line != "##source=bedgovcf v1.0.0" {
+		t.Fatalf("Expected ##source=bedgovcf v1.0.0, got %v", line)
+	}
+}
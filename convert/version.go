@@ -0,0 +1,276 @@
+package bedgovcf
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The VCF versions that can be written
+var vcfVersions = []string{"4.2", "4.3", "4.4"}
+
+// The pattern of valid INFO and FORMAT IDs
+var fieldIdPattern = regexp.MustCompile(`^([A-Za-z_][0-9A-Za-z_.]*|1000G)$`)
+
+// The definition of a reserved INFO or FORMAT field
+type reservedField struct {
+	Number      string // The number of values of the field
+	Type        string // The type of the field
+	Description string // The description of the field
+}
+
+// The reserved INFO fields of VCFv4.2
+var reservedInfo42 = map[string]reservedField{
+	"AA":        {"1", "String", "Ancestral allele"},
+	"AC":        {"A", "Integer", "Allele count in genotypes, for each ALT allele, in the same order as listed"},
+	"AF":        {"A", "Float", "Allele frequency for each ALT allele in the same order as listed"},
+	"AN":        {"1", "Integer", "Total number of alleles in called genotypes"},
+	"BQ":        {"1", "Float", "RMS base quality"},
+	"CIGAR":     {"A", "String", "Cigar string describing how to align an alternate allele to the reference allele"},
+	"DB":        {"0", "Flag", "dbSNP membership"},
+	"DP":        {"1", "Integer", "Combined depth across samples"},
+	"END":       {"1", "Integer", "End position of the variant described in this record"},
+	"H2":        {"0", "Flag", "HapMap2 membership"},
+	"H3":        {"0", "Flag", "HapMap3 membership"},
+	"MQ":        {"1", "Float", "RMS mapping quality"},
+	"MQ0":       {"1", "Integer", "Number of MAPQ == 0 reads"},
+	"NS":        {"1", "Integer", "Number of samples with data"},
+	"SB":        {"4", "Integer", "Strand bias"},
+	"SOMATIC":   {"0", "Flag", "Somatic mutation (for cancer genomics)"},
+	"VALIDATED": {"0", "Flag", "Validated by follow-up experiment"},
+	"1000G":     {"0", "Flag", "1000 Genomes membership"},
+	"IMPRECISE": {"0", "Flag", "Imprecise structural variation"},
+	"NOVEL":     {"0", "Flag", "Indicates a novel structural variation"},
+	"SVTYPE":    {"1", "String", "Type of structural variant"},
+	"SVLEN":     {".", "Integer", "Difference in length between REF and ALT alleles"},
+	"CIPOS":     {"2", "Integer", "Confidence interval around POS for imprecise variants"},
+	"CIEND":     {"2", "Integer", "Confidence interval around END for imprecise variants"},
+	"HOMLEN":    {".", "Integer", "Length of base pair identical micro-homology at event breakpoints"},
+	"HOMSEQ":    {".", "String", "Sequence of base pair identical micro-homology at event breakpoints"},
+	"BKPTID":    {".", "String", "ID of the assembled alternate allele in the assembly file"},
+	"MEINFO":    {"4", "String", "Mobile element info of the form NAME,START,END,POLARITY"},
+	"METRANS":   {"4", "String", "Mobile element transduction info of the form CHR,START,END,POLARITY"},
+	"DGVID":     {"1", "String", "ID of this element in Database of Genomic Variation"},
+	"DBVARID":   {"1", "String", "ID of this element in DBVAR"},
+	"DBRIPID":   {"1", "String", "ID of this element in DBRIP"},
+	"MATEID":    {".", "String", "ID of mate breakends"},
+	"PARID":     {"1", "String", "ID of partner breakend"},
+	"EVENT":     {"1", "String", "ID of event associated to breakend"},
+	"CILEN":     {"2", "Integer", "Confidence interval around the inserted material between breakends"},
+	"DPADJ":     {".", "Integer", "Read Depth of adjacency"},
+	"CN":        {"1", "Integer", "Copy number of segment containing breakend"},
+	"CNADJ":     {".", "Integer", "Copy number of adjacency"},
+	"CICN":      {"2", "Integer", "Confidence interval around copy number for the segment"},
+	"CICNADJ":   {".", "Integer", "Confidence interval around copy number for the adjacency"},
+}
+
+// The reserved FORMAT fields of VCFv4.2
+var reservedFormat42 = map[string]reservedField{
+	"AD":   {"R", "Integer", "Read depth for each allele"},
+	"ADF":  {"R", "Integer", "Read depth for each allele on the forward strand"},
+	"ADR":  {"R", "Integer", "Read depth for each allele on the reverse strand"},
+	"DP":   {"1", "Integer", "Read depth"},
+	"EC":   {"A", "Integer", "Expected alternate allele counts"},
+	"FT":   {"1", "String", "Filter indicating if this genotype was called"},
+	"GL":   {"G", "Float", "Genotype likelihoods"},
+	"GP":   {"G", "Float", "Genotype posterior probabilities"},
+	"GQ":   {"1", "Integer", "Conditional genotype quality"},
+	"GT":   {"1", "String", "Genotype"},
+	"HQ":   {"2", "Integer", "Haplotype quality"},
+	"MQ":   {"1", "Integer", "RMS mapping quality"},
+	"PL":   {"G", "Integer", "Phred-scaled genotype likelihoods rounded to the closest integer"},
+	"PQ":   {"1", "Integer", "Phasing quality"},
+	"PS":   {"1", "Integer", "Phase set"},
+	"CN":   {"1", "Integer", "Copy number genotype for imprecise events"},
+	"CNQ":  {"1", "Float", "Copy number genotype quality for imprecise events"},
+	"CNL":  {"G", "Float", "Copy number genotype likelihood for imprecise events"},
+	"CNP":  {"G", "Float", "Copy number posterior probabilities"},
+	"NQ":   {"1", "Integer", "Phred style probability score that the variant is novel"},
+	"HAP":  {"1", "Integer", "Unique haplotype identifier"},
+	"AHAP": {"1", "Integer", "Unique identifier of ancestral haplotype"},
+}
+
+// The changes to the reserved INFO fields in VCFv4.4
+var reservedInfo44 = map[string]reservedField{
+	"END":     {"1", "Integer", "End position on CHROM (used with symbolic alleles)"},
+	"SVLEN":   {"A", "Integer", "Length of structural variant"},
+	"SVCLAIM": {"A", "String", "Claim made by the structural variant call. Valid values are D, J, DJ for abundance, adjacency and both respectively"},
+	"CIPOS":   {".", "Integer", "Confidence interval around POS for symbolic structural variants"},
+	"CIEND":   {".", "Integer", "Confidence interval around END for symbolic structural variants"},
+	"CILEN":   {".", "Integer", "Confidence interval for the SVLEN field"},
+	"HOMLEN":  {"A", "Integer", "Length of base pair identical micro-homology at breakpoints"},
+	"HOMSEQ":  {"A", "String", "Sequence of base pair identical micro-homology at breakpoints"},
+	"MATEID":  {"A", "String", "ID of mate breakend"},
+	"EVENT":   {"A", "String", "ID of associated event"},
+	"CN":      {"A", "Float", "Copy number of CNV/breakpoint"},
+	"CICN":    {".", "Float", "Confidence interval around copy number"},
+}
+
+// The changes to the reserved FORMAT fields in VCFv4.4
+var reservedFormat44 = map[string]reservedField{
+	"CN":   {"1", "Float", "Copy number"},
+	"CICN": {"2", "Float", "Confidence interval around copy number"},
+	"CNQ":  {"1", "Float", "Copy number quality"},
+	"CNL":  {"G", "Float", "Copy number likelihoods"},
+	"CNP":  {"G", "Float", "Copy number posterior probabilities"},
+}
+
+// Get the reserved INFO or FORMAT fields of a VCF version
+func reservedFields(category string, version string) map[string]reservedField {
+	base, changes := reservedInfo42, reservedInfo44
+	if strings.ToUpper(category) == "FORMAT" {
+		base, changes = reservedFormat42, reservedFormat44
+	}
+
+	fields := map[string]reservedField{}
+	for id, field := range base {
+		fields[id] = field
+	}
+	if version == "4.4" {
+		for id, field := range changes {
+			fields[id] = field
+		}
+	}
+	return fields
+}
+
+// Get the VCF version from the command line or the config, defaults to 4.2
+func getVcfVersion(flag string, config Config) (string, error) {
+	version := flag
+	if version == "" {
+		version = config.Version
+	}
+	if version == "" {
+		return "4.2", nil
+	}
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "VCFv"), "v")
+	if !slices.Contains(vcfVersions, version) {
+		return "", fmt.Errorf("the VCF version (%v) is not supported, use one of %v", version, strings.Join(vcfVersions, ", "))
+	}
+	return version, nil
+}
+
+// Fill in the missing number, type and description of the reserved INFO and FORMAT fields of a VCF version
+// Returns a copy of the config and warnings for the fields that differ from their reserved definition
+func (c Config) withReservedFields(version string) (Config, []string) {
+	warnings := []string{}
+	for _, category := range []string{"INFO", "FORMAT"} {
+		fields := c.Info
+		if category == "FORMAT" {
+			fields = c.Format
+		}
+		reserved := reservedFields(category, version)
+
+		updated := SliceConfigInfoFormatStruct{}
+		for _, v := range fields {
+			definition, ok := reserved[strings.ToUpper(v.Name)]
+			if ok {
+				if v.Number == "" {
+					v.Number = definition.Number
+				}
+				if v.Type == "" {
+					v.Type = definition.Type
+				}
+				if v.Description == "" {
+					v.Description = definition.Description
+				}
+				if v.Number != definition.Number || !strings.EqualFold(v.Type, definition.Type) {
+					warnings = append(warnings, fmt.Sprintf("%v/%v (Number=%v, Type=%v) differs from its reserved definition in VCFv%v (Number=%v, Type=%v)", category, strings.ToUpper(v.Name), v.Number, v.Type, version, definition.Number, definition.Type))
+				}
+			}
+			updated = append(updated, v)
+		}
+
+		if category == "INFO" {
+			c.Info = updated
+		} else {
+			c.Format = updated
+		}
+	}
+	return c, warnings
+}
+
+// Apply the rules of a VCF version to the values of a variant
+// Characters with a special meaning are percent-encoded since VCFv4.3 and rejected in VCFv4.2
+func (v *Variant) applyVersion(version string) error {
+	for i, field := range v.Info {
+		// SVLEN is always positive since VCFv4.4
+		if version == "4.4" && strings.ToUpper(field.Name) == "SVLEN" {
+			v.Info[i].Value = absoluteValues(field.Value)
+		}
+	}
+
+	if version == "4.2" {
+		for _, field := range v.Info {
+			if err := checkValue("INFO", field, " \t\r\n;="); err != nil {
+				return err
+			}
+		}
+		for _, field := range v.Format {
+			if err := checkValue("FORMAT", field, " \t\r\n:"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, field := range v.Info {
+		v.Info[i].Value = percentEncode(field.Value, field.Number)
+	}
+	for i, field := range v.Format {
+		v.Format[i].Value = percentEncode(field.Value, field.Number)
+	}
+	return nil
+}
+
+// Check that an INFO or FORMAT value doesn't contain illegal characters (VCFv4.2)
+// Commas are only allowed in fields with multiple values, where they separate the values
+func checkValue(category string, field VariantInfoFormat, illegal string) error {
+	if strings.ContainsAny(field.Value, illegal) || (field.Number == "1" && strings.Contains(field.Value, ",")) {
+		return &ConversionError{
+			Field: fmt.Sprintf("%v/%v", category, strings.ToUpper(field.Name)),
+			Err:   fmt.Errorf("the value (%q) contains characters that are not allowed in VCFv4.2, use --vcf-version 4.3 or later to percent-encode them", field.Value),
+		}
+	}
+	return nil
+}
+
+// Check if an INFO or FORMAT ID is valid according to the VCF specification
+func isValidFieldId(id string) bool {
+	return fieldIdPattern.MatchString(strings.ToUpper(id))
+}
+
+// Convert the integers in a comma separated list to their absolute value
+func absoluteValues(value string) string {
+	values := strings.Split(value, ",")
+	for i, v := range values {
+		number, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && number < 0 {
+			values[i] = strconv.FormatInt(-number, 10)
+		}
+	}
+	return strings.Join(values, ",")
+}
+
+// Percent encode the characters with a special meaning in INFO and FORMAT values (VCFv4.3 and later)
+// Commas are only encoded in fields with a single value, in other fields they separate the values
+func percentEncode(value string, number string) string {
+	var encoded strings.Builder
+	for _, character := range value {
+		switch character {
+		case '%', ':', ';', '=', '\r', '\n', '\t':
+			fmt.Fprintf(&encoded, "%%%02X", character)
+		case ',':
+			if number == "1" {
+				encoded.WriteString("%2C")
+			} else {
+				encoded.WriteRune(character)
+			}
+		default:
+			encoded.WriteRune(character)
+		}
+	}
+	return encoded.String()
+}
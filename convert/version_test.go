@@ -0,0 +1,164 @@
+package bedgovcf
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGetVcfVersion(t *testing.T) {
+	var config Config
+	if err := yaml.Unmarshal([]byte("version: 4.3\n"), &config); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		flag     string
+		config   Config
+		expected string
+	}{
+		{"", Config{}, "4.2"},
+		{"", config, "4.3"},
+		{"4.4", config, "4.4"},
+		{"VCFv4.3", Config{}, "4.3"},
+	}
+	for _, test := range tests {
+		version, err := getVcfVersion(test.flag, test.config)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if version != test.expected {
+			t.Fatalf("Expected version %v, got %v", test.expected, version)
+		}
+	}
+
+	if _, err := getVcfVersion("4.1", Config{}); err == nil {
+		t.Fatalf("Expected an error for an unsupported version")
+	}
+}
+
+func TestReservedFields(t *testing.T) {
+	config := Config{
+		Info: SliceConfigInfoFormatStruct{
+			{Name: "svlen"},
+			{Name: "end", Type: "String"},
+			{Name: "custom"},
+		},
+		Format: SliceConfigInfoFormatStruct{
+			{Name: "cn", Description: "My copy number"},
+		},
+	}
+
+	updated, warnings := config.withReservedFields("4.2")
+	if updated.Info[0].Number != "." || updated.Info[0].Type != "Integer" {
+		t.Fatalf("Expected SVLEN to be Number=. and Type=Integer in VCFv4.2, got %v", updated.Info[0])
+	}
+	if updated.Format[0].Type != "Integer" || updated.Format[0].Description != "My copy number" {
+		t.Fatalf("Expected CN to be an Integer with the configured description in VCFv4.2, got %v", updated.Format[0])
+	}
+	if updated.Info[2].Number != "" || updated.Info[2].Type != "" {
+		t.Fatalf("Expected custom fields to be unchanged, got %v", updated.Info[2])
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning for END, got %v", warnings)
+	}
+	if config.Info[0].Type != "" {
+		t.Fatalf("Expected the original config to be unchanged")
+	}
+
+	updated, _ = config.withReservedFields("4.4")
+	if updated.Info[0].Number != "A" {
+		t.Fatalf("Expected SVLEN to be Number=A in VCFv4.4, got %v", updated.Info[0].Number)
+	}
+	if updated.Format[0].Type != "Float" {
+		t.Fatalf("Expected CN to be a Float in VCFv4.4, got %v", updated.Format[0].Type)
+	}
+}
+
+func TestApplyVersion(t *testing.T) {
+	newVariant := func() Variant {
+		return Variant{
+			Info: SliceVariantInfoFormat{
+				{Name: "SVLEN", Number: "A", Value: "-100"},
+				{Name: "NOTE", Number: "1", Value: "a;b=c,d"},
+				{Name: "LIST", Number: ".", Value: "a:b,c%d"},
+			},
+			Format: SliceVariantInfoFormat{
+				{Name: "GT", Number: "1", Value: "0/1"},
+				{Name: "NOTE", Number: "1", Value: "x:y"},
+			},
+		}
+	}
+
+	variant := newVariant()
+	variant.applyVersion("4.2")
+	if variant.Info[0].Value != "-100" || variant.Info[1].Value != "a;b=c,d" {
+		t.Fatalf("Expected the values to be unchanged in VCFv4.2, got %v", variant.Info)
+	}
+
+	variant = newVariant()
+	variant.applyVersion("4.3")
+	if variant.Info[0].Value != "-100" {
+		t.Fatalf("Expected SVLEN to keep its sign in VCFv4.3, got %v", variant.Info[0].Value)
+	}
+	if variant.Info[1].Value != "a%3Bb%3Dc%2Cd" {
+		t.Fatalf("Expected a%%3Bb%%3Dc%%2Cd, got %v", variant.Info[1].Value)
+	}
+	if variant.Info[2].Value != "a%3Ab,c%25d" {
+		t.Fatalf("Expected a%%3Ab,c%%25d, got %v", variant.Info[2].Value)
+	}
+	if variant.Format[0].Value != "0/1" || variant.Format[1].Value != "x%3Ay" {
+		t.Fatalf("Expected 0/1 and x%%3Ay, got %v", variant.Format)
+	}
+
+	variant = newVariant()
+	variant.applyVersion("4.4")
+	if variant.Info[0].Value != "100" {
+		t.Fatalf("Expected SVLEN to be positive in VCFv4.4, got %v", variant.Info[0].Value)
+	}
+}
+
+func TestIllegalValues(t *testing.T) {
+	variant := Variant{
+		Info: SliceVariantInfoFormat{{Name: "note", Number: ".", Value: "a b"}},
+	}
+	err := variant.applyVersion("4.2")
+	var conversionError *ConversionError
+	if !errors.As(err, &conversionError) || conversionError.Field != "INFO/NOTE" {
+		t.Fatalf("Expected a ConversionError for INFO/NOTE, got %v", err)
+	}
+
+	variant = Variant{
+		Format: SliceVariantInfoFormat{{Name: "note", Number: "1", Value: "a:b"}},
+	}
+	if err := variant.applyVersion("4.2"); err == nil {
+		t.Fatalf("Expected an error for a colon in a FORMAT value")
+	}
+
+	variant = Variant{
+		Info: SliceVariantInfoFormat{{Name: "list", Number: ".", Value: "1,2"}},
+	}
+	if err := variant.applyVersion("4.2"); err != nil {
+		t.Fatalf("Expected no error for a list, got %v", err)
+	}
+}
+
+func TestFieldIds(t *testing.T) {
+	for _, id := range []string{"SVLEN", "cnv_ratio", "_private", "A.B", "1000G"} {
+		if !isValidFieldId(id) {
+			t.Fatalf("Expected %v to be a valid ID", id)
+		}
+	}
+	for _, id := range []string{"1ABC", "has space", "A;B", "A=B", ""} {
+		if isValidFieldId(id) {
+			t.Fatalf("Expected %v to be an invalid ID", id)
+		}
+	}
+
+	header := Header{}
+	err := header.setHeaderLines(Config{Info: SliceConfigInfoFormatStruct{{Name: "bad id"}}})
+	if err == nil {
+		t.Fatalf("Expected an error for an invalid INFO ID")
+	}
+}
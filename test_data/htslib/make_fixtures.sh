@@ -0,0 +1,9 @@
+#!/usr/bin/env bash
+# Create the htslib fixtures of the index and BCF tests from index.vcf (needs bgzip, tabix and bcftools)
+set -euo pipefail
+cd "$(dirname "$0")"
+
+bgzip -c index.vcf > index.vcf.gz
+tabix -f -p vcf index.vcf.gz
+tabix -f -C -p vcf index.vcf.gz
+bcftools view --no-version -Ob -o index.bcf index.vcf